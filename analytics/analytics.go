@@ -0,0 +1,177 @@
+// Package analytics computes risk and performance metrics of a portfolio from
+// its equity curve and trades, and ranks players by them.
+package analytics
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Metrics describes how a portfolio performed and how much risk it took.
+// Returns are per snapshot of the equity curve, that is per price tick, and
+// are not annualized.
+type Metrics struct {
+	// Return is the relative change from the first to the last equity.
+	Return float64 `json:"return"`
+	// Volatility is the standard deviation of the returns.
+	Volatility float64 `json:"volatility"`
+	// Sharpe is the mean return divided by Volatility, with no risk-free
+	// rate. Sortino divides by the downside deviation instead.
+	Sharpe  float64 `json:"sharpe"`
+	Sortino float64 `json:"sortino"`
+	// MaxDrawdown is the largest fall from a peak of the equity curve, as a
+	// fraction of the peak.
+	MaxDrawdown float64 `json:"maxDrawdown"`
+	// WinRate is the fraction of ClosedTrades that made a profit.
+	ClosedTrades int     `json:"closedTrades"`
+	WinRate      float64 `json:"winRate"`
+	// Turnover is the value traded divided by the average equity.
+	Turnover float64 `json:"turnover"`
+	// Concentration is the share of the largest position in the gross value
+	// of the portfolio, cash included.
+	Concentration float64 `json:"concentration"`
+}
+
+// Input is what Compute needs to know about a portfolio.
+type Input struct {
+	// Equity is the equity curve, oldest first.
+	Equity []float64
+	// Closed is the realized profit or loss of every closed trade.
+	Closed []float64
+	// Traded is the total value of the trades.
+	Traded float64
+	// Holdings is the market value of every position, negative for short
+	// positions, and Cash the funds net of any loan.
+	Holdings []float64
+	Cash     float64
+}
+
+// Compute returns the metrics of in.
+func Compute(in Input) Metrics {
+	var m Metrics
+
+	returns := make([]float64, 0, len(in.Equity))
+	for i := 1; i < len(in.Equity); i++ {
+		if prev := in.Equity[i-1]; prev > 0 {
+			returns = append(returns, in.Equity[i]/prev-1)
+		}
+	}
+	if n := len(in.Equity); n > 1 && in.Equity[0] > 0 {
+		m.Return = in.Equity[n-1]/in.Equity[0] - 1
+	}
+	if len(returns) > 1 {
+		mean, downside := 0.0, 0.0
+		for _, r := range returns {
+			mean += r
+			downside += math.Pow(math.Min(r, 0), 2)
+		}
+		mean /= float64(len(returns))
+		variance := 0.0
+		for _, r := range returns {
+			variance += (r - mean) * (r - mean)
+		}
+		m.Volatility = math.Sqrt(variance / float64(len(returns)-1))
+		downside = math.Sqrt(downside / float64(len(returns)))
+		if m.Volatility > 0 {
+			m.Sharpe = mean / m.Volatility
+		}
+		if downside > 0 {
+			m.Sortino = mean / downside
+		}
+	}
+
+	peak := 0.0
+	for _, equity := range in.Equity {
+		peak = math.Max(peak, equity)
+		if peak > 0 {
+			m.MaxDrawdown = math.Max(m.MaxDrawdown, (peak-equity)/peak)
+		}
+	}
+
+	m.ClosedTrades = len(in.Closed)
+	if m.ClosedTrades > 0 {
+		wins := 0
+		for _, pnl := range in.Closed {
+			if pnl > 0 {
+				wins++
+			}
+		}
+		m.WinRate = float64(wins) / float64(m.ClosedTrades)
+	}
+
+	if len(in.Equity) > 0 {
+		average := 0.0
+		for _, equity := range in.Equity {
+			average += equity
+		}
+		average /= float64(len(in.Equity))
+		if average > 0 {
+			m.Turnover = in.Traded / average
+		}
+	}
+
+	gross, largest := math.Max(in.Cash, 0), 0.0
+	for _, value := range in.Holdings {
+		gross += math.Abs(value)
+		largest = math.Max(largest, math.Abs(value))
+	}
+	if gross > 0 {
+		m.Concentration = largest / gross
+	}
+	return m
+}
+
+// Rankings a leaderboard can be sorted by. RankValue is the usual final
+// value, RankSharpe the best risk-adjusted return.
+const (
+	RankValue    = "value"
+	RankReturn   = "return"
+	RankSharpe   = "sharpe"
+	RankSortino  = "sortino"
+	RankDrawdown = "drawdown"
+	RankWinRate  = "win_rate"
+)
+
+var ErrUnknownRanking = errors.New("rank must be one of value, return, sharpe, sortino, drawdown or win_rate")
+
+// Entry is one player on an analytics leaderboard.
+type Entry struct {
+	Rank    int     `json:"rank"`
+	Player  string  `json:"player"`
+	Value   float64 `json:"value"`
+	Metrics Metrics `json:"metrics"`
+}
+
+// Rank sorts entries best first by the ranking named by, ties broken by
+// value, and numbers them.
+func Rank(entries []Entry, by string) error {
+	var score func(e Entry) float64
+	switch by {
+	case RankValue:
+		score = func(e Entry) float64 { return e.Value }
+	case RankReturn:
+		score = func(e Entry) float64 { return e.Metrics.Return }
+	case RankSharpe:
+		score = func(e Entry) float64 { return e.Metrics.Sharpe }
+	case RankSortino:
+		score = func(e Entry) float64 { return e.Metrics.Sortino }
+	case RankDrawdown:
+		score = func(e Entry) float64 { return -e.Metrics.MaxDrawdown }
+	case RankWinRate:
+		score = func(e Entry) float64 { return e.Metrics.WinRate }
+	default:
+		return ErrUnknownRanking
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if a, b := score(entries[i]), score(entries[j]); a != b {
+			return a > b
+		}
+		return entries[i].Value > entries[j].Value
+	})
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+	return nil
+}
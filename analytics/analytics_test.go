@@ -0,0 +1,94 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+)
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestCompute(t *testing.T) {
+	m := Compute(Input{
+		// Returns of +10%, -10% and +10%.
+		Equity:   []float64{100, 110, 99, 108.9},
+		Closed:   []float64{5, -2, 0, 3},
+		Traded:   208.95,
+		Holdings: []float64{30, -50},
+		Cash:     20,
+	})
+
+	// The mean return is 1/30 and the sample deviation √(0.02/1.5).
+	volatility := math.Sqrt(0.02 / 1.5)
+	for _, c := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"return", m.Return, 0.089},
+		{"volatility", m.Volatility, volatility},
+		{"sharpe", m.Sharpe, (1.0 / 30) / volatility},
+		// Only the fall of 10% counts as downside, over all three returns.
+		{"sortino", m.Sortino, (1.0 / 30) / math.Sqrt(0.01/3)},
+		// From the peak of 110 down to 99.
+		{"max drawdown", m.MaxDrawdown, 0.1},
+		// A trade that broke even is not a win.
+		{"win rate", m.WinRate, 0.5},
+		// The average equity is 104.475.
+		{"turnover", m.Turnover, 2},
+		// The short position is half of 100 gross.
+		{"concentration", m.Concentration, 0.5},
+	} {
+		if !approx(c.got, c.want) {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+	if m.ClosedTrades != 4 {
+		t.Errorf("closed trades = %d, want 4", m.ClosedTrades)
+	}
+}
+
+func TestComputeWithoutHistory(t *testing.T) {
+	m := Compute(Input{Equity: []float64{100}, Cash: -10})
+	if m != (Metrics{}) {
+		t.Errorf("got %+v, want zero metrics", m)
+	}
+
+	// A curve that only rises has no downside and no drawdown.
+	m = Compute(Input{Equity: []float64{100, 110, 121}})
+	if m.Sortino != 0 || m.MaxDrawdown != 0 || !approx(m.Return, 0.21) {
+		t.Errorf("got %+v, want a 21%% return without downside", m)
+	}
+}
+
+func TestRank(t *testing.T) {
+	entries := []Entry{
+		{Player: "alice", Value: 900, Metrics: Metrics{Sharpe: 1, MaxDrawdown: 0.2, WinRate: 0.5}},
+		{Player: "bob", Value: 1100, Metrics: Metrics{Sharpe: 0.5, MaxDrawdown: 0.1, WinRate: 0.5}},
+		{Player: "carol", Value: 1000, Metrics: Metrics{Sharpe: 1, MaxDrawdown: 0.3, WinRate: 0.75}},
+	}
+	for _, tc := range []struct {
+		by   string
+		want []string
+	}{
+		{RankValue, []string{"bob", "carol", "alice"}},
+		// Equal Sharpe ratios fall back to value.
+		{RankSharpe, []string{"carol", "alice", "bob"}},
+		// The smallest drawdown ranks first.
+		{RankDrawdown, []string{"bob", "alice", "carol"}},
+		{RankWinRate, []string{"carol", "bob", "alice"}},
+	} {
+		if err := Rank(entries, tc.by); err != nil {
+			t.Fatalf("Rank(%s): %v", tc.by, err)
+		}
+		for i, player := range tc.want {
+			if entries[i].Player != player || entries[i].Rank != i+1 {
+				t.Errorf("by %s: rank %d is %s (%d), want %s", tc.by, i+1, entries[i].Player, entries[i].Rank, player)
+			}
+		}
+	}
+
+	if err := Rank(entries, "luck"); err != ErrUnknownRanking {
+		t.Errorf("got %v, want ErrUnknownRanking", err)
+	}
+}
@@ -0,0 +1,107 @@
+// Package auth hashes passwords and issues the signed bearer tokens that
+// identify players to the API and the WebSocket endpoint.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token expired")
+)
+
+// Claims is the payload carried by a token.
+type Claims struct {
+	Subject   string `json:"sub"`
+	Role      string `json:"role,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Signer issues and verifies HS256 JSON Web Tokens.
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewSigner returns a Signer whose tokens are valid for ttl.
+func NewSigner(secret []byte, ttl time.Duration) *Signer {
+	return &Signer{secret: secret, ttl: ttl}
+}
+
+var encoding = base64.RawURLEncoding
+
+// header is the fixed JWT header; only HS256 is ever issued or accepted.
+var header = encoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func (s *Signer) sign(data string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(data))
+	return encoding.EncodeToString(mac.Sum(nil))
+}
+
+// Issue returns a token for subject with the given role.
+func (s *Signer) Issue(subject, role string) (string, Claims, error) {
+	now := time.Now()
+	claims := Claims{
+		Subject:   subject,
+		Role:      role,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.ttl).Unix(),
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", claims, err
+	}
+	unsigned := header + "." + encoding.EncodeToString(payload)
+	return unsigned + "." + s.sign(unsigned), claims, nil
+}
+
+// Verify checks a token's signature and expiry and returns its claims.
+func (s *Signer) Verify(token string) (Claims, error) {
+	var claims Claims
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != header {
+		return claims, ErrInvalidToken
+	}
+	expected := s.sign(parts[0] + "." + parts[1])
+	if !hmac.Equal([]byte(parts[2]), []byte(expected)) {
+		return claims, ErrInvalidToken
+	}
+
+	payload, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Subject == "" {
+		return claims, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return claims, ErrExpiredToken
+	}
+	return claims, nil
+}
+
+// HashPassword returns the bcrypt hash of password.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches hash.
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,109 @@
+// controllers/adminController.go
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"midnight-trader/auth"
+	"midnight-trader/models"
+	"midnight-trader/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Audit records every admin action.
+var Audit store.AuditStore
+
+// AdminUsername is the name of the admin account. Players can't register
+// it, even while the admin account is disabled.
+var AdminUsername = "admin"
+
+// ErrAdminTaken is returned by EnsureAdmin when a player account already
+// has the admin's username.
+var ErrAdminTaken = errors.New("admin username belongs to a player account")
+
+// EnsureAdmin creates the admin account, or updates its password if it
+// already exists. It refuses to take over an existing player account.
+func EnsureAdmin(ctx context.Context, username, password string) error {
+	existing, err := Accounts.GetAccount(ctx, username)
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+	account := models.Account{Username: username, Role: models.RoleAdmin, CreatedAt: time.Now()}
+	if existing != nil {
+		if existing.Role != models.RoleAdmin {
+			return ErrAdminTaken
+		}
+		account.CreatedAt = existing.CreatedAt
+	}
+
+	account.PasswordHash, err = auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return Accounts.SaveAccount(ctx, account)
+}
+
+// AdminMiddleware only lets admins through and records each invocation,
+// along with the response status, in the audit log under action. It must run
+// after AuthMiddleware.
+func AdminMiddleware(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := c.MustGet(claimsKey).(auth.Claims)
+		if claims.Role != models.RoleAdmin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin role required"})
+			return
+		}
+
+		c.Next()
+
+		entry := models.AuditEntry{
+			Admin:  claims.Subject,
+			Action: action,
+			Method: c.Request.Method,
+			Path:   c.Request.URL.Path,
+			Status: c.Writer.Status(),
+			Time:   time.Now(),
+		}
+		if room, ok := c.Get(roomKey); ok {
+			entry.Room = room.(*Room).Name
+		}
+
+		// The request context may already be done once the handler has run.
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := Audit.RecordAudit(ctx, entry); err != nil {
+			log.Printf("Failed to record %s by %s: %v", action, claims.Subject, err)
+		}
+	}
+}
+
+// GetAuditLogHandler returns the most recent admin actions, newest first.
+func GetAuditLogHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 100
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+				return
+			}
+			limit = n
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		entries, err := Audit.ListAudit(ctx, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, entries)
+	}
+}
@@ -0,0 +1,218 @@
+// controllers/analyticsController.go
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"midnight-trader/analytics"
+	"midnight-trader/models"
+	"midnight-trader/store"
+	"midnight-trader/trading"
+
+	"github.com/gin-gonic/gin"
+)
+
+// holdings is what a player owned when their analytics are taken.
+type holdings struct {
+	player string
+	// cash is the player's funds, held back or not, net of the loan.
+	cash   float64
+	shares []map[string]int
+	// since is when the trades to replay start.
+	since time.Time
+	// value is the recorded final value, if there is one.
+	value    float64
+	hasValue bool
+}
+
+func portfolioHoldings(p models.Portfolio, since time.Time) holdings {
+	return holdings{
+		player: p.Player,
+		cash:   p.Funds + p.ReservedFunds - p.Loan,
+		shares: []map[string]int{p.Companies, p.ReservedShares},
+		since:  since,
+	}
+}
+
+// playerAnalytics computes the metrics of every participant of the round
+// with ID roundID from the trades made during it, or of every player over
+// their whole portfolio when roundID is 0. An ended round is taken from its
+// final standings at its closing prices, so later changes to the portfolios
+// don't alter it. Otherwise the current portfolios and prices are used, and
+// the equity curves end at the players' current equity.
+func (rm *RoundManagerWrapper) playerAnalytics(ctx context.Context, roundID int) ([]analytics.Entry, error) {
+	from, to := time.Time{}, time.Now()
+	var round *models.RoundState
+	if roundID != 0 {
+		var err error
+		if round, err = rm.Store.GetRound(ctx, roundID); err != nil {
+			return nil, err
+		}
+		from = round.StartTime
+	}
+	live := round == nil || round.Status != "ended"
+
+	var players []holdings
+	var prices map[string]float64
+	if live {
+		portfolios, err := rm.Store.ListPortfolios(ctx)
+		if err != nil {
+			return nil, err
+		}
+		companies, err := rm.Store.ListCompanies(ctx)
+		if err != nil {
+			return nil, err
+		}
+		prices = make(map[string]float64, len(companies))
+		for _, company := range companies {
+			prices[company.Ticker] = company.StockPrice
+		}
+
+		if round == nil {
+			for _, p := range portfolios {
+				players = append(players, portfolioHoldings(p, p.Since))
+			}
+		} else {
+			// Joining a round starts a fresh portfolio, so a round's trades
+			// are exactly those made during it. A participant whose
+			// portfolio is gone keeps the state the round last saw.
+			current := make(map[string]models.Portfolio, len(portfolios))
+			for _, p := range portfolios {
+				current[p.Player] = p
+			}
+			for _, p := range round.Participants {
+				if c, ok := current[p.Player]; ok {
+					p = c
+				}
+				players = append(players, portfolioHoldings(p, from))
+			}
+		}
+	} else {
+		to = round.EndTime
+		prices = round.EndPrices
+		for _, standing := range round.Leaderboard {
+			players = append(players, holdings{
+				player:   standing.Player,
+				cash:     standing.Funds + standing.ReservedFunds - standing.Loan,
+				shares:   []map[string]int{standing.Companies, standing.ReservedShares},
+				since:    from,
+				value:    standing.Value,
+				hasValue: true,
+			})
+		}
+	}
+
+	snapshots, err := rm.Store.ListEquity(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := rm.Store.ListTransactions(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	curves := make(map[string][]float64)
+	for _, snapshot := range snapshots {
+		if roundID == 0 || snapshot.RoundID == roundID {
+			curves[snapshot.Player] = append(curves[snapshot.Player], snapshot.Equity)
+		}
+	}
+	trades := make(map[string][]models.Trade)
+	for _, t := range transactions {
+		trades[t.Player] = append(trades[t.Player], t)
+	}
+	inWindow := func(t time.Time) bool {
+		return !t.Before(from) && !t.After(to)
+	}
+
+	entries := make([]analytics.Entry, 0, len(players))
+	for _, h := range players {
+		in := analytics.Input{
+			Equity: slices.Clone(curves[h.player]),
+			Cash:   h.cash,
+		}
+		equity := in.Cash
+		for _, shares := range h.shares {
+			for ticker, n := range shares {
+				value := float64(n) * prices[ticker]
+				in.Holdings = append(in.Holdings, value)
+				equity += value
+			}
+		}
+
+		var replayed []models.Trade
+		for _, t := range trades[h.player] {
+			if !t.Timestamp.Before(h.since) && !t.Timestamp.After(to) {
+				replayed = append(replayed, t)
+				in.Traded += t.Price * float64(t.Amount)
+			}
+		}
+		performance, err := trading.CostBasis(replayed, trading.CostFIFO, prices)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range performance.Realizations {
+			if inWindow(r.Timestamp) {
+				in.Closed = append(in.Closed, r.PnL)
+			}
+		}
+
+		if live {
+			in.Equity = append(in.Equity, equity)
+		}
+		entry := analytics.Entry{Player: h.player, Metrics: analytics.Compute(in)}
+		if h.hasValue {
+			entry.Value = h.value
+		} else if len(in.Equity) > 0 {
+			entry.Value = in.Equity[len(in.Equity)-1]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// GetAnalyticsHandler returns the risk and performance metrics of every
+// player, ranked by the "rank" query parameter: value (default), return,
+// sharpe, sortino, drawdown or win_rate. The "round" query parameter limits
+// the metrics to one round and "player" to one player.
+func GetAnalyticsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roundID := 0
+		if v := c.Query("round"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "round must be a positive integer"})
+				return
+			}
+			roundID = n
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		entries, err := RoomFrom(c).Rounds.playerAnalytics(ctx, roundID)
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Round not found."})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := analytics.Rank(entries, c.DefaultQuery("rank", analytics.RankValue)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if player := c.Query("player"); player != "" {
+			entries = slices.DeleteFunc(entries, func(e analytics.Entry) bool {
+				return e.Player != player
+			})
+		}
+		c.JSON(http.StatusOK, entries)
+	}
+}
@@ -0,0 +1,220 @@
+// controllers/authController.go
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"midnight-trader/auth"
+	"midnight-trader/models"
+	"midnight-trader/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Accounts stores the registered players of every room.
+var Accounts store.AccountStore
+
+// Tokens issues and verifies the bearer tokens handed out at login.
+var Tokens *auth.Signer
+
+// SetAuth sets the account store, audit log and token signer used by the
+// controllers.
+func SetAuth(accounts store.AccountStore, audit store.AuditStore, tokens *auth.Signer) {
+	Accounts = accounts
+	Audit = audit
+	Tokens = tokens
+}
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,32}$`)
+
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72 // bcrypt ignores anything longer
+)
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// tokenResponse issues a token for account and writes it as the response.
+func tokenResponse(c *gin.Context, account models.Account) {
+	token, claims, err := Tokens.Issue(account.Username, account.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue token: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"token":     token,
+		"player":    account.Username,
+		"role":      account.Role,
+		"expiresAt": time.Unix(claims.ExpiresAt, 0).UTC(),
+	})
+}
+
+// RegisterHandler creates an account and logs it in.
+func RegisterHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req credentials
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account data: " + err.Error()})
+			return
+		}
+		if !usernamePattern.MatchString(req.Username) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "username must be 3-32 letters, digits, dashes or underscores"})
+			return
+		}
+		if len(req.Password) < minPasswordLength || len(req.Password) > maxPasswordLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "password must be 8-72 characters"})
+			return
+		}
+		if strings.EqualFold(req.Username, AdminUsername) {
+			c.JSON(http.StatusConflict, gin.H{"error": "username already taken"})
+			return
+		}
+
+		hash, err := auth.HashPassword(req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		account := models.Account{
+			Username:     req.Username,
+			PasswordHash: hash,
+			CreatedAt:    time.Now(),
+		}
+		err = Accounts.CreateAccount(ctx, account)
+		if err == store.ErrDuplicate {
+			c.JSON(http.StatusConflict, gin.H{"error": "username already taken"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		tokenResponse(c, account)
+	}
+}
+
+// LoginHandler exchanges a username and password for a bearer token.
+func LoginHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req credentials
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid login data: " + err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		account, err := Accounts.GetAccount(ctx, req.Username)
+		if err != nil && err != store.ErrNotFound {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if account == nil || !auth.CheckPassword(account.PasswordHash, req.Password) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
+			return
+		}
+
+		tokenResponse(c, *account)
+	}
+}
+
+// MeHandler returns the account behind the request's token.
+func MeHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		account, err := Accounts.GetAccount(ctx, CurrentPlayer(c))
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, account)
+	}
+}
+
+const (
+	claimsKey     = "claims"
+	queryTokenKey = "queryToken"
+)
+
+// bearerToken returns the token from the Authorization header.
+func bearerToken(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return ""
+}
+
+// StripQueryToken removes the "token" query parameter from every request
+// before anything logs the URL, keeping it for WebSocketAuthMiddleware only.
+// It must come before the request logger.
+func StripQueryToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := c.Request.URL.Query()
+		if token := query.Get("token"); token != "" {
+			query.Del("token")
+			c.Request.URL.RawQuery = query.Encode()
+			c.Set(queryTokenKey, token)
+		}
+		c.Next()
+	}
+}
+
+// AuthMiddleware rejects requests without a valid bearer token in the
+// Authorization header and records the authenticated player for
+// CurrentPlayer.
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authenticate(c, bearerToken(c))
+	}
+}
+
+// WebSocketAuthMiddleware is AuthMiddleware for the WebSocket handshake.
+// Browsers cannot set headers on it, so the token may come from the "token"
+// query parameter instead.
+func WebSocketAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c)
+		if token == "" {
+			token = c.GetString(queryTokenKey)
+		}
+		authenticate(c, token)
+	}
+}
+
+func authenticate(c *gin.Context, token string) {
+	if token == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+	claims, err := Tokens.Verify(token)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	c.Set(claimsKey, claims)
+	c.Next()
+}
+
+// CurrentPlayer returns the player authenticated by AuthMiddleware.
+func CurrentPlayer(c *gin.Context) string {
+	return c.MustGet(claimsKey).(auth.Claims).Subject
+}
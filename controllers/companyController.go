@@ -1,33 +1,26 @@
 package controllers
 
 import (
-	"midnight-trader/models"
-
 	"context"
 	"net/http"
+	"strconv"
 	"time"
 
+	"midnight-trader/indicators"
+	"midnight-trader/trading"
+
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
 func GetCompanies(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var companies []models.Company
-	cursor, err := CompanyCollection.Find(ctx, bson.M{})
+	companies, err := RoomFrom(c).Store.ListCompanies(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer cursor.Close(ctx)
-
-	for cursor.Next(ctx) {
-		var company models.Company
-		cursor.Decode(&company)
-		companies = append(companies, company)
-	}
 
 	c.JSON(http.StatusOK, companies)
 }
@@ -35,44 +28,156 @@ func GetCompaniesHandler(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	var companies []models.Company
-	cursor, err := CompanyCollection.Find(ctx, bson.M{})
+	companies, err := RoomFrom(c).Store.ListCompanies(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer cursor.Close(ctx)
 
-	for cursor.Next(ctx) {
-		var company models.Company
-		cursor.Decode(&company)
-		companies = append(companies, company)
+	c.JSON(http.StatusOK, companies)
+}
+
+// GetCandlesHandler returns the most recent OHLCV candles of a company. The
+// "interval" query parameter is the candle length as a Go duration between 1s
+// and 24h, 1m by default, and "limit" the number of candles, 200 by default.
+func GetCandlesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ticker := c.Param("ticker")
+
+		interval := time.Minute
+		if v := c.Query("interval"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < time.Second || d > 24*time.Hour {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be a duration between 1s and 24h, e.g. 30s or 5m"})
+				return
+			}
+			interval = d
+		}
+		limit := 200
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+				return
+			}
+			limit = n
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		candles, err := RoomFrom(c).Trading.CompanyCandles(ctx, ticker, interval)
+		if err == trading.ErrCompanyNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "company not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(candles) > limit {
+			candles = candles[len(candles)-limit:]
+		}
+		c.JSON(http.StatusOK, candles)
 	}
+}
 
-	c.JSON(http.StatusOK, companies)
+// GetIndicatorsHandler returns technical indicators over a company's price
+// history and trade volume. Without the "interval" query parameter every
+// price tick is a data point, otherwise every candle of that length. "limit"
+// is the number of data points, 200 by default; "period" sets the SMA, EMA
+// and Bollinger Bands period and "rsi" the RSI period.
+func GetIndicatorsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ticker := c.Param("ticker")
+
+		var interval time.Duration
+		if v := c.Query("interval"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < time.Second || d > 24*time.Hour {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be a duration between 1s and 24h, e.g. 30s or 5m"})
+				return
+			}
+			interval = d
+		}
+		params := map[string]int{"limit": 200, "period": indicators.DefaultPeriod, "rsi": indicators.DefaultRSIPeriod}
+		for name := range params {
+			if v := c.Query(name); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n <= 0 {
+					c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a positive integer"})
+					return
+				}
+				params[name] = n
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		candles, err := RoomFrom(c).Trading.CompanyCandles(ctx, ticker, interval)
+		if err == trading.ErrCompanyNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "company not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		set := indicators.FromCandles(candles, params["period"], params["rsi"]).Tail(params["limit"])
+		c.JSON(http.StatusOK, gin.H{"ticker": ticker, "indicators": set})
+	}
 }
 
 func ClearData(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err := CompanyCollection.Drop(ctx)
+	room := RoomFrom(c)
+
+	err := room.Store.ClearCompanies(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear companies"})
 		return
 	}
 
-	err = tradeCollection.Drop(ctx)
+	err = room.Store.ClearTrades(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear trades"})
 		return
 	}
 
-	err = PortfolioCollection.Drop(ctx)
+	err = room.Store.ClearPortfolios(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear portfolios"})
 		return
 	}
 
+	err = room.Store.ClearOrders(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear orders"})
+		return
+	}
+
+	err = room.Store.ClearConditionalOrders(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear conditional orders"})
+		return
+	}
+
+	err = room.Store.ClearNews(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear news"})
+		return
+	}
+
+	err = room.Store.ClearEquity(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear equity history"})
+		return
+	}
+	room.Trading.ResetOrderBooks()
+
 	c.JSON(http.StatusOK, gin.H{"message": "All game data cleared"})
 }
@@ -0,0 +1,89 @@
+// controllers/equityController.go
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"midnight-trader/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// snapshotEquity records the equity of every player at current prices and
+// broadcasts it with an "equity_updated" event for the live race chart. It
+// runs on every price tick.
+func (rm *RoundManagerWrapper) snapshotEquity(ctx context.Context) {
+	equities, err := rm.Trading.Equities(ctx)
+	if err != nil {
+		log.Println("Failed to compute equities:", err)
+		return
+	}
+	if len(equities) == 0 {
+		return
+	}
+
+	roundID := rm.ActiveRoundID()
+	now := time.Now()
+	snapshots := make([]models.EquitySnapshot, 0, len(equities))
+	for player, equity := range equities {
+		snapshots = append(snapshots, models.EquitySnapshot{
+			Player:  player,
+			RoundID: roundID,
+			Equity:  equity,
+			Time:    now,
+		})
+	}
+	if err := rm.Store.InsertEquity(ctx, snapshots); err != nil {
+		log.Println("Failed to save equity snapshots:", err)
+		return
+	}
+
+	rm.Hub.Broadcast <- models.WSMessage{
+		Event: "equity_updated",
+		Data: gin.H{
+			"round_id": roundID,
+			"time":     now,
+			"equity":   equities,
+		},
+	}
+}
+
+// GetPortfolioHistoryHandler returns the equity snapshots of the player named
+// by the "player" query parameter, or of every player, oldest first. The
+// "round" query parameter limits them to one round.
+func GetPortfolioHistoryHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roundID := 0
+		if v := c.Query("round"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "round must be a positive integer"})
+				return
+			}
+			roundID = n
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		snapshots, err := RoomFrom(c).Store.ListEquity(ctx, c.Query("player"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if roundID != 0 {
+			filtered := snapshots[:0]
+			for _, snapshot := range snapshots {
+				if snapshot.RoundID == roundID {
+					filtered = append(filtered, snapshot)
+				}
+			}
+			snapshots = filtered
+		}
+		c.JSON(http.StatusOK, snapshots)
+	}
+}
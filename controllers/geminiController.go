@@ -1,430 +1,249 @@
 package controllers
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"strconv"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
+	"midnight-trader/jobs"
+	"midnight-trader/llm"
 	"midnight-trader/models"
+	"midnight-trader/store"
 )
 
-func extractAIResponse(result map[string]interface{}) (string, error) {
-	candidates, ok := result["candidates"].([]interface{})
-	if !ok || len(candidates) == 0 {
-		return "", fmt.Errorf("no candidates found in AI response")
-	}
+// companyCount is the number of companies GenerateCompanies asks for.
+const companyCount = 9
 
-	firstCandidate, ok := candidates[0].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("invalid candidate format")
-	}
+var tickerPattern = regexp.MustCompile(`^[A-Z]{3,4}$`)
 
-	content, ok := firstCandidate["content"].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("no content found in candidate")
-	}
+// generatedCompany is the schema of one company written by the model.
+type generatedCompany struct {
+	Name        string  `json:"name"`
+	Ticker      string  `json:"ticker"`
+	Description string  `json:"description"`
+	StockPrice  float64 `json:"stockPrice"`
+	Sector      string  `json:"sector"`
+}
+
+// problems collects validation failures into a single error.
+type problems []string
+
+func (p *problems) addf(format string, args ...interface{}) {
+	*p = append(*p, fmt.Sprintf(format, args...))
+}
 
-	parts, ok := content["parts"].([]interface{})
-	if !ok || len(parts) == 0 {
-		return "", fmt.Errorf("no parts found in content")
+func (p problems) err() error {
+	if len(p) == 0 {
+		return nil
 	}
+	return errors.New(strings.Join(p, "; "))
+}
 
-	firstPart, ok := parts[0].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("invalid part format")
+// validateCompanies checks that exactly companyCount companies with unique
+// 3-4 letter tickers, names, descriptions, sectors and positive prices were
+// generated.
+func validateCompanies(companies []generatedCompany) error {
+	var p problems
+	if len(companies) != companyCount {
+		p.addf("expected %d companies, got %d", companyCount, len(companies))
+	}
+	seen := make(map[string]bool)
+	for i, comp := range companies {
+		if !tickerPattern.MatchString(comp.Ticker) {
+			p.addf("company %d: ticker %q must be 3-4 uppercase letters", i+1, comp.Ticker)
+		} else if seen[comp.Ticker] {
+			p.addf("company %d: duplicate ticker %s", i+1, comp.Ticker)
+		}
+		seen[comp.Ticker] = true
+		if strings.TrimSpace(comp.Name) == "" {
+			p.addf("company %d: missing name", i+1)
+		}
+		if strings.TrimSpace(comp.Description) == "" {
+			p.addf("company %d: missing description", i+1)
+		}
+		if strings.TrimSpace(comp.Sector) == "" {
+			p.addf("company %d: missing sector", i+1)
+		}
+		if !(comp.StockPrice > 0) || math.IsInf(comp.StockPrice, 0) {
+			p.addf("company %d: stockPrice must be a positive number", i+1)
+		}
 	}
+	return p.err()
+}
 
-	text, ok := firstPart["text"].(string)
-	if !ok {
-		return "", fmt.Errorf("no text found in part")
+// validatePrices checks that data holds exactly one series of seriesLength
+// positive prices for every company and nothing else.
+func validatePrices(data map[string][]float64, companies []models.Company) error {
+	var p problems
+	known := make(map[string]bool, len(companies))
+	for _, comp := range companies {
+		known[comp.Ticker] = true
+		if _, ok := data[comp.Ticker]; !ok {
+			p.addf("missing series for %s", comp.Ticker)
+		}
+	}
+	for _, ticker := range slices.Sorted(maps.Keys(data)) {
+		prices := data[ticker]
+		if !known[ticker] {
+			p.addf("unknown ticker %s", ticker)
+			continue
+		}
+		if len(prices) != seriesLength {
+			p.addf("%s: expected %d prices, got %d", ticker, seriesLength, len(prices))
+		}
+		for _, price := range prices {
+			if !(price > 0) || math.IsInf(price, 0) {
+				p.addf("%s: prices must be positive numbers", ticker)
+				break
+			}
+		}
 	}
+	return p.err()
+}
 
-	return text, nil
+// progressModel reports every request to the model as a step of a job.
+type progressModel struct {
+	llm.TextGenerator
+	progress jobs.Progress
+	attempt  int
 }
-func GenerateCompanies(c *gin.Context) {
-	// context for mongodb ops
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
 
-	// drop old companies
-	if err := CompanyCollection.Drop(ctx); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to drop existing companies: " + err.Error()})
-		return
-	}
+func (m *progressModel) Generate(ctx context.Context, prompt string) (string, error) {
+	m.attempt++
+	m.progress(0.1+0.7*float64(m.attempt-1)/float64(aiAttempts), fmt.Sprintf("asking the model (attempt %d of %d)", m.attempt, aiAttempts))
+	return m.TextGenerator.Generate(ctx, prompt)
+}
 
-	// generate companies via gemini
-	prompt := `generate data for 9 fictional companies for a stock trading game.
+// generateCompanies replaces the room's companies with new ones written by
+// the model.
+func generateCompanies(ctx context.Context, room *Room, progress jobs.Progress) ([]models.Company, error) {
+	// generate companies via the model
+	prompt := fmt.Sprintf(`generate data for %d fictional companies for a stock trading game.
 for each company, provide:
 - company name (realistic sounding tech or pharma company name)
-- company ticker (3-4 letter abbreviation)
+- company ticker (3-4 uppercase letters, unique)
 - short description (1-2 sentences describing their business)
-- starting stock price (a realistic stock price as a floating point number)
+- starting stock price (a realistic, positive stock price as a json number)
+- sector (one word such as "tech" or "pharma"; several companies should share a sector)
 
-format the response as a json array of objects. each object should have the keys: "name", "ticker", "description", "stockPrice".`
+format the response as a json array of exactly %d objects. each object should have the keys: "name", "ticker", "description", "stockPrice", "sector".`, companyCount, companyCount)
 
-	reqBody, err := json.Marshal(map[string]interface{}{
-		"contents": []map[string]interface{}{
-			{
-				"parts": []map[string]string{
-					{"text": prompt},
-				},
-			},
-		},
+	var generated []generatedCompany
+	model := &progressModel{TextGenerator: TextAI, progress: progress}
+	err := llm.GenerateJSON(ctx, model, prompt, aiAttempts, &generated, func() error {
+		return validateCompanies(generated)
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to marshal request body: " + err.Error()})
-		return
+		return nil, fmt.Errorf("failed to fetch ai-generated companies: %v", err)
 	}
 
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/gemini-1.5-flash:generateContent?key=%s", geminiApiKey)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(reqBody))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch ai-generated companies: " + err.Error()})
-		return
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read response body: " + err.Error()})
-		return
+	// convert to models.Company
+	companies := make([]models.Company, 0, len(generated))
+	for _, comp := range generated {
+		companies = append(companies, models.Company{
+			Name:                  comp.Name,
+			Ticker:                comp.Ticker,
+			Description:           comp.Description,
+			StockPrice:            comp.StockPrice,
+			Sector:                strings.ToLower(comp.Sector),
+			HistoricalStockPrices: []float64{comp.StockPrice},
+		})
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse ai response: " + err.Error()})
-		return
+	// replace the old companies in the store
+	progress(0.9, "saving companies")
+	if err := room.Store.ReplaceCompanies(ctx, companies); err != nil {
+		return nil, fmt.Errorf("failed to insert companies: %v", err)
 	}
+	return companies, nil
+}
 
-	log.Println("gemini api response:", string(body))
+// GenerateCompanies queues a job that replaces the room's companies with
+// ones written by the model.
+func GenerateCompanies(c *gin.Context) {
+	room := RoomFrom(c)
+	submitJob(c, "generate_companies", func(ctx context.Context, progress jobs.Progress) (interface{}, error) {
+		return generateCompanies(ctx, room, progress)
+	})
+}
 
-	responseText, err := extractAIResponse(result)
+// generatePrices asks the model for a series of prices for every company,
+// keyed by ticker, re-prompting until the series pass validatePrices. It
+// then stores the series with save and publishes the last price of each.
+// instructions is the part of the prompt that differs between generating and
+// appending.
+func generatePrices(ctx context.Context, room *Room, progress jobs.Progress, instructions string, save func(ctx context.Context, ticker string, prices []float64) error) (map[string][]float64, error) {
+	// fetch existing companies from the store
+	companies, err := room.Store.ListCompanies(ctx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to extract AI response: " + err.Error()})
-		return
-	}
-
-	// clean up code fences (note newline sensitivity)
-	cleanedJSON := strings.TrimPrefix(responseText, "```json\n")
-	cleanedJSON = strings.TrimSuffix(cleanedJSON, "```\n")
-	cleanedJSON = strings.TrimSpace(cleanedJSON)
-
-	var companiesData []map[string]interface{}
-	if err := json.Unmarshal([]byte(cleanedJSON), &companiesData); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse cleaned json: " + err.Error()})
-		return
+		return nil, fmt.Errorf("failed to fetch companies: %v", err)
 	}
 
-	// convert to models.Company
-	var companies []models.Company
-	for _, comp := range companiesData {
-		name, _ := comp["name"].(string)
-		ticker, _ := comp["ticker"].(string)
-		description, _ := comp["description"].(string)
-		var stockPrice float64
-		switch v := comp["stockPrice"].(type) {
-		case float64:
-			stockPrice = v
-		case string:
-			stockPrice, err = strconv.ParseFloat(v, 64)
-			if err != nil {
-				stockPrice = 0
-			}
-		default:
-			stockPrice = 0
-		}
-		companies = append(companies, models.Company{
-			Name:                  name,
-			Ticker:                ticker,
-			Description:           description,
-			StockPrice:            stockPrice,
-			HistoricalStockPrices: []float64{stockPrice},
-		})
-	}
-
-	// insert into mongodb
-	companyDocs := make([]interface{}, len(companies))
-	for i, company := range companies {
-		companyDocs[i] = company
+	// marshal companies to json string for prompt
+	companiesData, err := json.Marshal(companies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal companies: %v", err)
 	}
 
-	_, err = CompanyCollection.InsertMany(ctx, companyDocs)
+	prompt := fmt.Sprintf(`%s
+the input is a json array of companies with keys "name", "ticker", "description", "stockPrice", "historicalStockPrices".
+for each company, generate an array of exactly %d historical prices (positive json numbers).
+format the response as a json object where each key is a company ticker and the value is the array of prices. include every company and no other keys.
+here's the companies data: %s`, instructions, seriesLength, string(companiesData))
+
+	// expected format: map[ticker][]float64
+	var historicalData map[string][]float64
+	model := &progressModel{TextGenerator: TextAI, progress: progress}
+	err = llm.GenerateJSON(ctx, model, prompt, aiAttempts, &historicalData, func() error {
+		return validatePrices(historicalData, companies)
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to insert companies: " + err.Error()})
-		return
+		return nil, fmt.Errorf("failed to fetch ai-generated historical data: %v", err)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "new companies generated", "companies": companies})
+	// Update each company with its prices and set stockPrice to the latest one
+	progress(0.9, "saving prices")
+	for ticker, prices := range historicalData {
+		err := save(ctx, ticker, prices)
+		if err == store.ErrNotFound {
+			log.Printf("no document updated for ticker %s", ticker)
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to update company %s: %v", ticker, err)
+		}
+		// Emit stock_update event
+		room.Trading.PublishPrice(ticker, prices[len(prices)-1])
+	}
+	return historicalData, nil
 }
 
-func GenerateHistoricalData(hub *models.Hub) gin.HandlerFunc {
+// GenerateHistoricalData queues a job that overwrites every company's price
+// history with one written by the model.
+func GenerateHistoricalData() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ctx, cancel := context.WithTimeout(context.Background(), 9*time.Second)
-		defer cancel()
-
-		// fetch existing companies from mongo
-		var companies []models.Company
-		cursor, err := CompanyCollection.Find(ctx, bson.M{})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch companies: " + err.Error()})
-			return
-		}
-		defer cursor.Close(ctx)
-		for cursor.Next(ctx) {
-			var comp models.Company
-			if err := cursor.Decode(&comp); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode company: " + err.Error()})
-				return
-			}
-			companies = append(companies, comp)
-		}
-		if err := cursor.Err(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "cursor error: " + err.Error()})
-			return
-		}
-
-		// marshal companies to json string for prompt
-		companiesData, err := json.Marshal(companies)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to marshal companies: " + err.Error()})
-			return
-		}
-
-		// build gemini prompt using existing companies data
-		prompt := fmt.Sprintf(`generate historical stock price data for a stock trading game.
-the input is a json array of companies with keys "name", "ticker", "description", "stockPrice", "historicalStockPrices".
-for each company, generate an array of 10 historical prices (floating point numbers).
-dates don't matter. Make sure there are winners and losers. Some companies must FAIL badly. Some will make people very rich. We want to see a variety of price movements between the stocks.
-format the response as a json object where each key is a company ticker and the value is the array of prices.
-here's the companies data: %s`, string(companiesData))
-
-		reqBody, err := json.Marshal(map[string]interface{}{
-			"contents": []map[string]interface{}{
-				{
-					"parts": []map[string]string{
-						{"text": prompt},
-					},
-				},
-			},
+		room := RoomFrom(c)
+		submitJob(c, "generate_data", func(ctx context.Context, progress jobs.Progress) (interface{}, error) {
+			return generatePrices(ctx, room, progress, `generate historical stock price data for a stock trading game.
+dates don't matter. Make sure there are winners and losers. Some companies must FAIL badly. Some will make people very rich. We want to see a variety of price movements between the stocks.`, room.Store.SetCompanyPrices)
 		})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to marshal request body: " + err.Error()})
-			return
-		}
-
-		url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/gemini-1.5-flash:generateContent?key=%s", geminiApiKey)
-		resp, err := http.Post(url, "application/json", bytes.NewBuffer(reqBody))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch ai-generated historical data: " + err.Error()})
-			return
-		}
-		defer resp.Body.Close()
-
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read response body: " + err.Error()})
-			return
-		}
-
-		var result map[string]interface{}
-		if err := json.Unmarshal(body, &result); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse ai response: " + err.Error()})
-			return
-		}
-
-		// Usage within your handler:
-		responseText, err := extractAIResponse(result)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to extract AI response: " + err.Error()})
-			return
-		}
-
-		// remove code fences if present
-		cleanedJSON := strings.TrimPrefix(responseText, "```json\n")
-		cleanedJSON = strings.TrimSuffix(cleanedJSON, "```\n")
-		cleanedJSON = strings.TrimSpace(cleanedJSON)
-
-		// expected format: map[ticker][]float64
-		var historicalData map[string][]float64
-		if err := json.Unmarshal([]byte(cleanedJSON), &historicalData); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse historical data json: " + err.Error()})
-			return
-		}
-
-		// Update each company with its historical stock prices and update stockPrice to the latest price
-		for ticker, prices := range historicalData {
-			if len(prices) == 0 {
-				log.Printf("no historical prices provided for ticker %s", ticker)
-				continue
-			}
-			latestPrice := prices[len(prices)-1]
-			message := models.WSMessage{
-				Event: "stock_update",
-				Data: map[string]interface{}{
-					"ticker": ticker,
-					"price":  latestPrice,
-				},
-			}
-			hub.Broadcast <- message
-			filter := bson.M{"ticker": ticker}
-			update := bson.M{
-				"$set": bson.M{
-					"historicalStockPrices": prices,
-					"stockPrice":            latestPrice,
-				},
-			}
-			res, err := CompanyCollection.UpdateOne(ctx, filter, update)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update company " + ticker + ": " + err.Error()})
-				return
-			}
-			if res.ModifiedCount == 0 {
-				log.Printf("no document updated for ticker %s", ticker)
-			}
-		}
-
-		c.JSON(http.StatusOK, gin.H{"message": "historical data updated", "data": historicalData})
 	}
 }
 
-func AppendGeneratedHistoricalData(hub *models.Hub) gin.HandlerFunc {
+// AppendGeneratedHistoricalData queues a job that extends every company's
+// price history with prices written by the model.
+func AppendGeneratedHistoricalData() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-
-		// fetch existing companies from mongo
-		var companies []models.Company
-		cursor, err := CompanyCollection.Find(ctx, bson.M{})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch companies: " + err.Error()})
-			return
-		}
-		defer cursor.Close(ctx)
-		for cursor.Next(ctx) {
-			var comp models.Company
-			if err := cursor.Decode(&comp); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode company: " + err.Error()})
-				return
-			}
-			companies = append(companies, comp)
-		}
-		if err := cursor.Err(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "cursor error: " + err.Error()})
-			return
-		}
-
-		// marshal companies to json string for prompt
-		companiesData, err := json.Marshal(companies)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to marshal companies: " + err.Error()})
-			return
-		}
-
-		// build gemini prompt using existing companies data
-		prompt := fmt.Sprintf(`generate additional historical stock price data for a stock trading game.
-	the input is a json array of companies with keys "name", "ticker", "description", "stockPrice", "historicalStockPrices".
-	for each company, generate an array of 10 historical prices (floating point numbers).
-	dates don't matter. Make sure there are winners and losers. Some companies must FAIL badly. Some will make people very rich. Try not to repeat the same prices, we don't want heavy seasonality within 10 days! We want to see a variety of price movements between the stocks. If the ending price is not change greater than $50 of the last appended price, we will consider the data as not updated, Also a bus of children will be exploded.
-	format the response as a json object where each key is a company ticker and the value is the array of prices.
-	here's the companies data: %s`, string(companiesData))
-
-		reqBody, err := json.Marshal(map[string]interface{}{
-			"contents": []map[string]interface{}{
-				{
-					"parts": []map[string]string{
-						{"text": prompt},
-					},
-				},
-			},
+		room := RoomFrom(c)
+		submitJob(c, "append_data", func(ctx context.Context, progress jobs.Progress) (interface{}, error) {
+			return generatePrices(ctx, room, progress, `generate additional historical stock price data for a stock trading game.
+dates don't matter. Make sure there are winners and losers. Some companies must FAIL badly. Some will make people very rich. Try not to repeat the same prices, we don't want heavy seasonality within 10 days! We want to see a variety of price movements between the stocks. The ending price should differ from the last recorded price by more than $50.`, room.Store.AppendCompanyPrices)
 		})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to marshal request body: " + err.Error()})
-			return
-		}
-
-		url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/gemini-1.5-flash:generateContent?key=%s", geminiApiKey) // fix here
-		resp, err := http.Post(url, "application/json", bytes.NewBuffer(reqBody))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch ai-generated historical data: " + err.Error()})
-			return
-		}
-		defer resp.Body.Close()
-
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read response body: " + err.Error()})
-			return
-		}
-
-		var result map[string]interface{}
-		if err := json.Unmarshal(body, &result); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse ai response: " + err.Error()})
-			return
-		}
-
-		// Usage within your handler:
-		responseText, err := extractAIResponse(result)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to extract AI response: " + err.Error()})
-			return
-		}
-
-		// remove code fences if present
-		cleanedJSON := strings.TrimPrefix(responseText, "```json\n")
-		cleanedJSON = strings.TrimSuffix(cleanedJSON, "```\n")
-		cleanedJSON = strings.TrimSpace(cleanedJSON)
-
-		// expected format: map[ticker][]float64
-		var historicalData map[string][]float64
-		if err := json.Unmarshal([]byte(cleanedJSON), &historicalData); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse historical data json: " + err.Error()})
-			return
-		}
-
-		// Update each company with its historical stock prices and update stockPrice to the latest appended price
-		for ticker, prices := range historicalData {
-			if len(prices) == 0 {
-				log.Printf("no historical prices provided for ticker %s", ticker)
-				continue
-			}
-			latestAppendedPrice := prices[len(prices)-1]
-
-			filter := bson.M{"ticker": ticker}
-			update := bson.M{
-				"$push": bson.M{"historicalStockPrices": bson.M{"$each": prices}},
-				"$set": bson.M{
-					"stockPrice": latestAppendedPrice,
-				},
-			}
-			res, err := CompanyCollection.UpdateOne(ctx, filter, update)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update company " + ticker + ": " + err.Error()})
-				return
-			}
-			if res.ModifiedCount == 0 {
-				log.Printf("no document updated for ticker %s", ticker)
-			}
-			// Emit stock_update event
-			message := models.WSMessage{
-				Event: "stock_update",
-				Data: map[string]interface{}{
-					"ticker": ticker,
-					"price":  latestAppendedPrice,
-				},
-			}
-			hub.Broadcast <- message
-
-		}
-
-		c.JSON(http.StatusOK, gin.H{"message": "historical data appended", "data": historicalData})
 	}
 }
@@ -1,45 +1,120 @@
 package controllers
 
 import (
-	"context"
+	"encoding/json"
+	"fmt"
 	"log"
+	"math"
 	"os"
+	"strconv"
 
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"midnight-trader/llm"
+	"midnight-trader/models"
 )
 
-var geminiApiKey string
+// TextAI is the language model behind every generation endpoint and the
+// LLM news.
+var TextAI llm.TextGenerator
 
+// aiAttempts is how many answers a generation asks TextAI for before it
+// gives up on invalid output.
+var aiAttempts = llm.DefaultAttempts
+
+// InitAI selects the language model from AI_PROVIDER:
+//
+//   - "gemini" (the default) uses GEMINI_API_KEY and GEMINI_MODEL
+//   - "openai" uses OPENAI_BASE_URL, OPENAI_API_KEY and OPENAI_MODEL, and
+//     works with any OpenAI-compatible server
+//   - "canned" answers with fixed data and needs no network
+//
+// Gemini without an API key falls back to the canned answers. Invalid
+// output is re-prompted up to AI_MAX_ATTEMPTS answers in all.
 func InitAI() {
-	geminiApiKey = os.Getenv("GEMINI_API_KEY")
-	if geminiApiKey == "" {
-		log.Fatal("gemini_api_key not set in environment")
+	if v := os.Getenv("AI_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatalf("Invalid AI_MAX_ATTEMPTS %q", v)
+		}
+		aiAttempts = n
+	}
+
+	provider := os.Getenv("AI_PROVIDER")
+	if provider == "" {
+		provider = "gemini"
+	}
+
+	switch provider {
+	case "gemini":
+		key := os.Getenv("GEMINI_API_KEY")
+		if key == "" {
+			log.Println("GEMINI_API_KEY not set; using canned AI responses")
+			TextAI = cannedAI()
+			return
+		}
+		TextAI = &llm.Gemini{APIKey: key, Model: os.Getenv("GEMINI_MODEL")}
+	case "openai":
+		model := os.Getenv("OPENAI_MODEL")
+		if model == "" {
+			log.Fatal("OPENAI_MODEL must be set for AI_PROVIDER=openai")
+		}
+		TextAI = &llm.OpenAI{
+			BaseURL: os.Getenv("OPENAI_BASE_URL"),
+			APIKey:  os.Getenv("OPENAI_API_KEY"),
+			Model:   model,
+		}
+	case "canned":
+		TextAI = cannedAI()
+	default:
+		log.Fatalf("Invalid AI_PROVIDER %q", provider)
 	}
+	log.Println("AI provider:", provider)
 }
 
-// MongoDB collections
-var (
-	PortfolioCollection *mongo.Collection
-	CompanyCollection   *mongo.Collection
-)
+// cannedCompanies are the companies the canned model "generates".
+var cannedCompanies = []models.Company{
+	{Name: "Nimbus Compute", Ticker: "NMBS", Description: "Rents out GPU clusters to startups.", StockPrice: 142.5, Sector: "tech"},
+	{Name: "Quantix Labs", Ticker: "QTX", Description: "Builds error-corrected quantum processors.", StockPrice: 87.2, Sector: "tech"},
+	{Name: "Helio Networks", Ticker: "HELN", Description: "Operates a low-orbit satellite internet constellation.", StockPrice: 54.8, Sector: "tech"},
+	{Name: "Vantage Robotics", Ticker: "VRB", Description: "Makes warehouse picking robots.", StockPrice: 33.1, Sector: "tech"},
+	{Name: "Corvex Therapeutics", Ticker: "CRVX", Description: "Develops gene therapies for rare blood disorders.", StockPrice: 61.4, Sector: "pharma"},
+	{Name: "Medira Biosciences", Ticker: "MDRA", Description: "Runs late-stage trials of a new class of antibiotics.", StockPrice: 27.9, Sector: "pharma"},
+	{Name: "Aurelian Health", Ticker: "AURH", Description: "Sells generic drugs across three continents.", StockPrice: 112.3, Sector: "pharma"},
+	{Name: "Pallas Diagnostics", Ticker: "PLDX", Description: "Makes at-home blood testing kits.", StockPrice: 19.6, Sector: "pharma"},
+	{Name: "Synapse Neurotech", Ticker: "SYNT", Description: "Develops implantable brain-computer interfaces.", StockPrice: 245.0, Sector: "tech"},
+}
 
-// Initialize MongoDB collections
-func SetPortfolioCollection(db *mongo.Database) {
-	PortfolioCollection = db.Collection("portfolios")
+// cannedAI returns a model that answers the game's prompts with fixed data:
+// cannedCompanies, ten prices per company following a fixed trend, and a
+// single headline.
+func cannedAI() llm.TextGenerator {
+	companies, err := json.Marshal(cannedCompanies)
+	if err != nil {
+		log.Fatalf("Failed to marshal canned companies: %v", err)
+	}
 
-	// Create a unique index on the "player" field
-	indexModel := mongo.IndexModel{
-		Keys:    bson.M{"player": 1}, // Index on "player" field, ascending
-		Options: options.Index().SetUnique(true),
+	prices := make(map[string][]float64, len(cannedCompanies))
+	for i, c := range cannedCompanies {
+		// Alternate winners and losers of varying strength.
+		growth := 0.01 * float64(i+1)
+		if i%2 == 1 {
+			growth = -growth
+		}
+		series := make([]float64, 10)
+		for k := range series {
+			series[k] = math.Round(c.StockPrice*math.Pow(1+growth, float64(k+1))*100) / 100
+		}
+		prices[c.Ticker] = series
 	}
-	_, err := PortfolioCollection.Indexes().CreateOne(context.TODO(), indexModel)
+	series, err := json.Marshal(prices)
 	if err != nil {
-		log.Fatalf("Failed to create unique index on player field: %v", err)
+		log.Fatalf("Failed to marshal canned prices: %v", err)
 	}
-}
 
-func SetCompanyCollection(db *mongo.Database) {
-	CompanyCollection = db.Collection("companies")
+	return &llm.Canned{Responses: []llm.CannedResponse{
+		{Match: "fictional companies", Text: string(companies)},
+		{Match: "historical stock price data", Text: string(series)},
+		{Match: "breaking news", Text: fmt.Sprintf(
+			`{"ticker": %q, "sector": "", "headline": "%s shares jump on surprise contract win", "body": "The deal is worth more than the company's annual revenue.", "shock": 0.08}`,
+			cannedCompanies[0].Ticker, cannedCompanies[0].Name)},
+	}}
 }
@@ -0,0 +1,66 @@
+// controllers/jobController.go
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"midnight-trader/jobs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultJobTimeout bounds how long a generation job may run.
+const DefaultJobTimeout = 5 * time.Minute
+
+// submitJob queues task as a job of the room and responds with the job. The
+// outcome is reported through "job_updated" events and GetJobHandler.
+func submitJob(c *gin.Context, kind string, task jobs.Task) {
+	job, err := RoomFrom(c).Jobs.Submit(kind, CurrentPlayer(c), task)
+	if err == jobs.ErrQueueFull {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "job queued", "job": job})
+}
+
+// GetJobsHandler lists the room's recent jobs, newest first.
+func GetJobsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, RoomFrom(c).Jobs.List())
+	}
+}
+
+// GetJobHandler returns a single job by ID.
+func GetJobHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, ok := RoomFrom(c).Jobs.Get(c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": jobs.ErrNotFound.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// CancelJobHandler cancels a queued or running job. A running job reports
+// "cancelled" once its task has stopped.
+func CancelJobHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, err := RoomFrom(c).Jobs.Cancel(c.Param("id"))
+		switch err {
+		case nil:
+			c.JSON(http.StatusOK, gin.H{"message": "job cancelled", "job": job})
+		case jobs.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case jobs.ErrFinished:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "job": job})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"midnight-trader/jobs"
+	"midnight-trader/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// seriesLength is the number of prices produced per company by one generate call.
+const seriesLength = 10
+
+// SimulateHistoricalData overwrites every company's price history with a
+// freshly simulated series. The series restarts from the company's first
+// recorded price, so the same seed always yields the same history.
+func SimulateHistoricalData(ctx context.Context, room *Room) (map[string][]float64, error) {
+	var historicalData map[string][]float64
+	err := room.Trading.MoveMarket(func() error {
+		companies, err := room.Store.ListCompanies(ctx)
+		if err != nil {
+			return err
+		}
+		room.Market.Sync(companies)
+
+		historicalData = make(map[string][]float64, len(companies))
+		for _, company := range companies {
+			start := company.StockPrice
+			if len(company.HistoricalStockPrices) > 0 {
+				start = company.HistoricalStockPrices[0]
+			}
+			if err := room.Market.Reset(company.Ticker, start); err != nil {
+				return err
+			}
+			// The engine clamps non-positive prices, so read back where it starts.
+			start, _ = room.Market.Price(company.Ticker)
+			rest, err := room.Market.Series(company.Ticker, seriesLength-1)
+			if err != nil {
+				return err
+			}
+			prices := append([]float64{start}, rest...)
+
+			if err := room.Store.SetCompanyPrices(ctx, company.Ticker, prices); err == store.ErrNotFound {
+				log.Printf("no document updated for ticker %s", company.Ticker)
+			} else if err != nil {
+				return err
+			}
+			historicalData[company.Ticker] = prices
+			room.Trading.PublishPrice(company.Ticker, prices[len(prices)-1])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return historicalData, nil
+}
+
+// SimulateAppendHistoricalData continues every company's price series by
+// seriesLength ticks from its current price.
+func SimulateAppendHistoricalData(ctx context.Context, room *Room) (map[string][]float64, error) {
+	var historicalData map[string][]float64
+	err := room.Trading.MoveMarket(func() error {
+		companies, err := room.Store.ListCompanies(ctx)
+		if err != nil {
+			return err
+		}
+		room.Market.Sync(companies)
+
+		historicalData = make(map[string][]float64, len(companies))
+		for _, company := range companies {
+			prices, err := room.Market.Series(company.Ticker, seriesLength)
+			if err != nil {
+				return err
+			}
+
+			if err := room.Store.AppendCompanyPrices(ctx, company.Ticker, prices); err == store.ErrNotFound {
+				log.Printf("no document updated for ticker %s", company.Ticker)
+			} else if err != nil {
+				return err
+			}
+			historicalData[company.Ticker] = prices
+			room.Trading.PublishPrice(company.Ticker, prices[len(prices)-1])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return historicalData, nil
+}
+
+// SimulateHistoricalDataHandler queues a job that regenerates price history
+// with the local engine. It runs as a job like its LLM counterpart, so
+// clients handle both price sources the same way.
+func SimulateHistoricalDataHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		room := RoomFrom(c)
+		submitJob(c, "generate_data", func(ctx context.Context, progress jobs.Progress) (interface{}, error) {
+			historicalData, err := SimulateHistoricalData(ctx, room)
+			if err != nil {
+				return nil, fmt.Errorf("failed to simulate historical data: %v", err)
+			}
+			return historicalData, nil
+		})
+	}
+}
+
+// SimulateAppendHistoricalDataHandler queues a job that appends simulated
+// prices with the local engine.
+func SimulateAppendHistoricalDataHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		room := RoomFrom(c)
+		submitJob(c, "append_data", func(ctx context.Context, progress jobs.Progress) (interface{}, error) {
+			historicalData, err := SimulateAppendHistoricalData(ctx, room)
+			if err != nil {
+				return nil, fmt.Errorf("failed to simulate historical data: %v", err)
+			}
+			return historicalData, nil
+		})
+	}
+}
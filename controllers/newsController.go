@@ -0,0 +1,148 @@
+// controllers/newsController.go
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"midnight-trader/models"
+	"midnight-trader/news"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newsTimeout bounds how long a headline may take to write, which matters
+// when it comes from the LLM.
+const newsTimeout = 30 * time.Second
+
+// newsGenerator returns the headline writer for a room: TextAI with the
+// templates as fallback when source is "llm", otherwise just the templates.
+func newsGenerator(source string, seed int64) news.Generator {
+	templates := news.NewTemplateGenerator(seed)
+	if source == "llm" {
+		return &news.LLMGenerator{Model: TextAI, Attempts: aiAttempts, Fallback: templates}
+	}
+	return templates
+}
+
+// maybePublishNews writes and publishes a headline with probability
+// NewsChance. It runs in the background so a slow model never delays the
+// price ticks, and skips the draw while an earlier headline is in progress.
+func (rm *RoundManagerWrapper) maybePublishNews() {
+	if rm.News == nil || rm.newsRNG == nil {
+		return
+	}
+	rm.newsMu.Lock()
+	draw := rm.newsRNG.Float64()
+	rm.newsMu.Unlock()
+	if draw >= rm.NewsChance {
+		return
+	}
+	if !rm.newsBusy.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer rm.newsBusy.Store(false)
+
+		ctx, cancel := context.WithTimeout(context.Background(), newsTimeout)
+		defer cancel()
+
+		companies, err := rm.Store.ListCompanies(ctx)
+		if err != nil {
+			log.Println("Failed to fetch companies for news:", err)
+			return
+		}
+		if len(companies) == 0 {
+			return
+		}
+		item, err := rm.News.Generate(ctx, companies)
+		if err != nil {
+			log.Println("Failed to generate news:", err)
+			return
+		}
+		if _, err := rm.PublishNews(ctx, item); err != nil {
+			log.Println("Failed to publish news:", err)
+		}
+	}()
+}
+
+// PublishNews applies the price shock of item to every company it affects,
+// stores it and broadcasts it with a "news" event.
+func (rm *RoundManagerWrapper) PublishNews(ctx context.Context, item models.News) (models.News, error) {
+	item.ID = models.NewID()
+	item.RoundID = rm.ActiveRoundID()
+	item.Time = time.Now()
+
+	// Start from the stored prices, which trades may have moved since the
+	// last tick, and keep trades out until the shocked prices are stored.
+	err := rm.Trading.MoveMarket(func() error {
+		companies, err := rm.Store.ListCompanies(ctx)
+		if err != nil {
+			return err
+		}
+		tickers := news.Affected(item, companies)
+		if len(tickers) == 0 {
+			return fmt.Errorf("news %q affects no company", item.Headline)
+		}
+
+		item.Prices = make(map[string]float64, len(tickers))
+		rm.Market.Sync(companies)
+		for _, ticker := range tickers {
+			price, err := rm.Market.Shock(ticker, item.Shock)
+			if err != nil {
+				return err
+			}
+			if err := rm.Store.AppendCompanyPrices(ctx, ticker, []float64{price}); err != nil {
+				return err
+			}
+			item.Prices[ticker] = price
+		}
+		return nil
+	})
+	if err != nil {
+		return item, err
+	}
+
+	if err := rm.Store.InsertNews(ctx, item); err != nil {
+		return item, err
+	}
+	rm.Hub.Broadcast <- models.WSMessage{
+		Event: "news",
+		Data:  item,
+	}
+	for ticker, price := range item.Prices {
+		rm.Trading.PublishPrice(ticker, price)
+	}
+	log.Printf("News: %s (%+.1f%%)", item.Headline, item.Shock*100)
+	return item, nil
+}
+
+// GetNewsHandler returns the most recent news of the room, newest first.
+func GetNewsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 50
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+				return
+			}
+			limit = n
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		items, err := RoomFrom(c).Store.ListNews(ctx, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	}
+}
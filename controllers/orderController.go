@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"midnight-trader/models"
+	"midnight-trader/orderbook"
+	"midnight-trader/trading"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PlaceOrderHandler handles submitting a limit or market order to the book.
+func PlaceOrderHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Ticker   string  `json:"ticker"`
+			Side     string  `json:"side"`
+			Type     string  `json:"type"`
+			Price    float64 `json:"price"`
+			Quantity int     `json:"quantity"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order data: " + err.Error()})
+			return
+		}
+		if req.Type == "" {
+			req.Type = "limit"
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		order, fills, err := RoomFrom(c).Trading.PlaceOrder(ctx, models.Order{
+			Player:   CurrentPlayer(c),
+			Ticker:   req.Ticker,
+			Side:     req.Side,
+			Type:     req.Type,
+			Price:    req.Price,
+			Quantity: req.Quantity,
+		})
+		if err != nil {
+			status := http.StatusBadRequest
+			if err == trading.ErrCompanyNotFound {
+				status = http.StatusNotFound
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Order placed", "order": order, "fills": fills})
+	}
+}
+
+// GetOrdersHandler lists orders, optionally filtered by player.
+func GetOrdersHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		player := CurrentPlayer(c)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		orders, err := RoomFrom(c).Store.ListOrders(ctx, player)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, orders)
+	}
+}
+
+// CancelOrderHandler cancels one of the requesting player's resting orders.
+func CancelOrderHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		player := CurrentPlayer(c)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		order, err := RoomFrom(c).Trading.CancelOrder(ctx, player, c.Param("id"))
+		switch err {
+		case nil:
+		case orderbook.ErrOrderNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		case orderbook.ErrNotOwner:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Order cancelled", "order": order})
+	}
+}
+
+// PlaceConditionalOrderHandler handles submitting a stop-loss, take-profit,
+// trailing stop or stop-limit order.
+func PlaceConditionalOrderHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Ticker       string  `json:"ticker"`
+			Side         string  `json:"side"`
+			Type         string  `json:"type"`
+			Quantity     int     `json:"quantity"`
+			TriggerPrice float64 `json:"triggerPrice"`
+			LimitPrice   float64 `json:"limitPrice"`
+			TrailPercent float64 `json:"trailPercent"`
+			TrailAmount  float64 `json:"trailAmount"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order data: " + err.Error()})
+			return
+		}
+		if req.Side == "" {
+			req.Side = "sell"
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		order, err := RoomFrom(c).Trading.PlaceConditionalOrder(ctx, models.ConditionalOrder{
+			Player:       CurrentPlayer(c),
+			Ticker:       req.Ticker,
+			Side:         req.Side,
+			Type:         req.Type,
+			Quantity:     req.Quantity,
+			TriggerPrice: req.TriggerPrice,
+			LimitPrice:   req.LimitPrice,
+			TrailPercent: req.TrailPercent,
+			TrailAmount:  req.TrailAmount,
+		})
+		if err != nil {
+			status := http.StatusBadRequest
+			if err == trading.ErrCompanyNotFound {
+				status = http.StatusNotFound
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Conditional order placed", "order": order})
+	}
+}
+
+// GetConditionalOrdersHandler lists the requesting player's conditional
+// orders, including triggered and cancelled ones.
+func GetConditionalOrdersHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		orders, err := RoomFrom(c).Store.ListConditionalOrders(ctx, CurrentPlayer(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, orders)
+	}
+}
+
+// CancelConditionalOrderHandler cancels one of the requesting player's
+// pending conditional orders.
+func CancelConditionalOrderHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		order, err := RoomFrom(c).Trading.CancelConditionalOrder(ctx, CurrentPlayer(c), c.Param("id"))
+		switch err {
+		case nil:
+		case orderbook.ErrOrderNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		case orderbook.ErrNotOwner:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Conditional order cancelled", "order": order})
+	}
+}
+
+// GetOrderBookHandler returns the aggregated depth of a ticker's book.
+func GetOrderBookHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ticker := c.Param("ticker")
+		bids, asks := RoomFrom(c).Trading.OrderBook(ticker)
+		c.JSON(http.StatusOK, gin.H{
+			"ticker": ticker,
+			"bids":   bids,
+			"asks":   asks,
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// controllers/roomController.go
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"midnight-trader/auth"
+	"midnight-trader/models"
+	"midnight-trader/trading"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateRoomHandler creates a new game room owned by the current player.
+// Settings left out of the request are taken from defaults.
+func CreateRoomHandler(defaults RoomConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Name              string             `json:"name"`
+			Unlisted          bool               `json:"unlisted"`
+			RoundDuration     string             `json:"roundDuration"`
+			TotalRounds       *int               `json:"totalRounds"`
+			LobbyDuration     string             `json:"lobbyDuration"`
+			CountdownDuration string             `json:"countdownDuration"`
+			MinPlayers        int                `json:"minPlayers"`
+			Seed              *int64             `json:"seed"`
+			Fees              *trading.FeeConfig `json:"fees"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room data: " + err.Error()})
+			return
+		}
+
+		cfg := defaults
+		cfg.Unlisted = req.Unlisted
+		cfg.Seed = time.Now().UnixNano()
+		if req.Seed != nil {
+			cfg.Seed = *req.Seed
+		}
+		if req.TotalRounds != nil {
+			if *req.TotalRounds < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "totalRounds must not be negative"})
+				return
+			}
+			cfg.TotalRounds = *req.TotalRounds
+		}
+		if req.Fees != nil {
+			if req.Fees.Flat < 0 || req.Fees.Percent < 0 || req.Fees.Minimum < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "fees must not be negative"})
+				return
+			}
+			cfg.Fees = *req.Fees
+		}
+		if req.MinPlayers < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "minPlayers must not be negative"})
+			return
+		}
+		if req.MinPlayers > 0 {
+			cfg.MinPlayers = req.MinPlayers
+		}
+		for _, d := range []struct {
+			name  string
+			value string
+			field *time.Duration
+		}{
+			{"roundDuration", req.RoundDuration, &cfg.RoundDuration},
+			{"lobbyDuration", req.LobbyDuration, &cfg.LobbyDuration},
+			{"countdownDuration", req.CountdownDuration, &cfg.CountdownDuration},
+		} {
+			if d.value == "" {
+				continue
+			}
+			parsed, err := time.ParseDuration(d.value)
+			if err != nil || parsed <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + d.name + ": " + d.value})
+				return
+			}
+			*d.field = parsed
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		// Rooms created by admins don't count towards anyone's limit.
+		owner := CurrentPlayer(c)
+		if c.MustGet(claimsKey).(auth.Claims).Role == models.RoleAdmin {
+			owner = ""
+		}
+
+		room, err := CreateRoom(ctx, req.Name, owner, cfg)
+		switch err {
+		case nil:
+		case ErrInvalidRoomName:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case ErrRoomExists:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case ErrTooManyRooms:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "room created", "room": room.Info()})
+	}
+}
+
+// ListRoomsHandler lists every room that isn't unlisted.
+func ListRoomsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		infos := []models.RoomInfo{}
+		for _, room := range ListRooms() {
+			if !room.Unlisted {
+				infos = append(infos, room.Info())
+			}
+		}
+		c.JSON(http.StatusOK, infos)
+	}
+}
+
+// GetRoomHandler returns a single room by name, including unlisted ones.
+func GetRoomHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		room, ok := GetRoom(c.Param("name"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "room not found"})
+			return
+		}
+		c.JSON(http.StatusOK, room.Info())
+	}
+}
@@ -0,0 +1,320 @@
+// controllers/roomManager.go
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"midnight-trader/jobs"
+	"midnight-trader/market"
+	"midnight-trader/models"
+	"midnight-trader/store"
+	"midnight-trader/trading"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultRoom is the room used by requests that don't name one.
+const DefaultRoom = "main"
+
+const (
+	// DefaultMaxRooms caps the number of rooms on the server.
+	DefaultMaxRooms = 50
+	// DefaultMaxRoomsPerOwner caps the rooms one player may create.
+	DefaultMaxRoomsPerOwner = 3
+)
+
+var (
+	ErrRoomExists      = errors.New("room already exists")
+	ErrInvalidRoomName = errors.New("room name must be 1-32 lowercase letters, digits or dashes")
+	ErrTooManyRooms    = errors.New("too many rooms")
+)
+
+var roomNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// RoomConfig holds the settings a room is created with.
+type RoomConfig struct {
+	RoundDuration     time.Duration
+	TotalRounds       int
+	TickInterval      time.Duration
+	LobbyDuration     time.Duration
+	CountdownDuration time.Duration
+	MinPlayers        int
+	Seed              int64
+	Unlisted          bool // unlisted rooms are reachable by name but not listed
+	// Margin sets the requirements for short selling and leverage; the zero
+	// value means trading.DefaultMargin.
+	Margin trading.MarginConfig
+	// Fees is the commission charged on every trade in the room.
+	Fees trading.FeeConfig
+	// Impact is the liquidity model that moves prices on trades at market.
+	Impact trading.ImpactConfig
+	// NewsSource is "llm" to have the language model write the news, or anything else
+	// for the built-in templates.
+	NewsSource string
+	// NewsChance is the probability of a headline on each price tick; zero
+	// disables news.
+	NewsChance float64
+	// Indicators follows "stock_update" events with the latest technical
+	// indicators in "stock_indicators" events.
+	Indicators bool
+}
+
+// Room is an independent game: it has its own data, price engine, order
+// books, rounds and WebSocket audience.
+type Room struct {
+	Name      string
+	Unlisted  bool
+	CreatedAt time.Time
+	// Owner is the player who created the room, empty for rooms the server
+	// or an admin created.
+	Owner string
+
+	Store      store.Store
+	Market     *market.Engine
+	Trading    *trading.Service
+	Hub        *models.Hub
+	Rounds     *RoundManagerWrapper
+	Controller *RoundController
+	// Jobs runs the room's generation jobs one at a time.
+	Jobs *jobs.Manager
+}
+
+// Info summarizes the room for listings.
+func (r *Room) Info() models.RoomInfo {
+	info := models.RoomInfo{
+		Name:      r.Name,
+		Unlisted:  r.Unlisted,
+		CreatedAt: r.CreatedAt,
+	}
+
+	r.Rounds.RoundLock.Lock()
+	defer r.Rounds.RoundLock.Unlock()
+	info.TotalRounds = r.Rounds.TotalRounds
+	info.CompletedRounds = r.Rounds.CompletedRounds
+	if round := r.Rounds.CurrentRound; round != nil {
+		info.RoundID = round.ID
+		info.Status = round.Status
+		info.Players = len(round.Participants)
+	}
+	return info
+}
+
+var (
+	roomsMu sync.RWMutex
+	rooms   = make(map[string]*Room)
+	// creating holds the owners of the rooms being set up by name, so that
+	// nobody takes the name meanwhile.
+	creating = make(map[string]string)
+
+	// maxRooms caps the number of rooms and maxRoomsPerOwner the rooms one
+	// player may create. Zero means no limit.
+	maxRooms, maxRoomsPerOwner int
+
+	// openRoomStore returns the persistence backend for a room.
+	openRoomStore func(ctx context.Context, room string) (store.Store, error)
+)
+
+// SetRoomStoreFactory sets how each new room gets its store.
+func SetRoomStoreFactory(open func(ctx context.Context, room string) (store.Store, error)) {
+	openRoomStore = open
+}
+
+// SetRoomLimits caps the number of rooms in total and per owner. Zero means
+// no limit.
+func SetRoomLimits(total, perOwner int) {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+	maxRooms, maxRoomsPerOwner = total, perOwner
+}
+
+// CreateRoom sets up a new room owned by owner and opens the lobby for its
+// first round. An empty owner is the server or an admin, whose rooms only
+// count towards the total limit. Rooms are not persisted themselves, but
+// their data is: creating a room with the name of an earlier one picks up
+// its companies, portfolios and open orders again.
+func CreateRoom(ctx context.Context, name, owner string, cfg RoomConfig) (*Room, error) {
+	if !roomNamePattern.MatchString(name) {
+		return nil, ErrInvalidRoomName
+	}
+	if err := reserveRoom(name, owner); err != nil {
+		return nil, err
+	}
+
+	// Opening the store may take a while, so it happens outside roomsMu
+	// with the name reserved.
+	room, err := newRoom(ctx, name, owner, cfg)
+	roomsMu.Lock()
+	delete(creating, name)
+	if err == nil {
+		rooms[name] = room
+	}
+	roomsMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Room %s created (market seed %d)", name, cfg.Seed)
+
+	room.Rounds.Start()
+	return room, nil
+}
+
+// reserveRoom claims name for a room being created by owner, failing if the
+// name is taken or a limit is reached.
+func reserveRoom(name, owner string) error {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+
+	if _, ok := rooms[name]; ok {
+		return ErrRoomExists
+	}
+	if _, ok := creating[name]; ok {
+		return ErrRoomExists
+	}
+	if maxRooms > 0 && len(rooms)+len(creating) >= maxRooms {
+		return ErrTooManyRooms
+	}
+	if owner != "" && maxRoomsPerOwner > 0 {
+		owned := 0
+		for _, room := range rooms {
+			if room.Owner == owner {
+				owned++
+			}
+		}
+		for _, o := range creating {
+			if o == owner {
+				owned++
+			}
+		}
+		if owned >= maxRoomsPerOwner {
+			return ErrTooManyRooms
+		}
+	}
+	creating[name] = owner
+	return nil
+}
+
+// newRoom opens the store of a room and wires up its services, without
+// starting its rounds.
+func newRoom(ctx context.Context, name, owner string, cfg RoomConfig) (*Room, error) {
+	s, err := openRoomStore(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for room %s: %v", name, err)
+	}
+
+	hub := models.NewHub()
+	engine := market.NewEngine(cfg.Seed)
+	tradingService := trading.NewService(s, hub)
+	if cfg.Margin != (trading.MarginConfig{}) {
+		tradingService.Margin = cfg.Margin
+	}
+	tradingService.Fees = cfg.Fees
+	tradingService.Impact = cfg.Impact
+	tradingService.Indicators = cfg.Indicators
+	if err := tradingService.RestoreOrderBooks(ctx); err != nil {
+		return nil, fmt.Errorf("failed to restore order books for room %s: %v", name, err)
+	}
+	if err := tradingService.RestoreConditionalOrders(ctx); err != nil {
+		return nil, fmt.Errorf("failed to restore conditional orders for room %s: %v", name, err)
+	}
+
+	rm := NewRoundManager(hub, cfg.RoundDuration, cfg.TotalRounds)
+	rm.TickInterval = cfg.TickInterval
+	rm.LobbyDuration = cfg.LobbyDuration
+	rm.CountdownDuration = cfg.CountdownDuration
+	rm.MinPlayers = cfg.MinPlayers
+	rm.Store = s
+	rm.Market = engine
+	rm.Trading = tradingService
+	if cfg.NewsChance > 0 {
+		rm.News = newsGenerator(cfg.NewsSource, cfg.Seed)
+		rm.NewsChance = cfg.NewsChance
+		rm.newsRNG = rand.New(rand.NewPCG(uint64(cfg.Seed), 2))
+	}
+	tradingService.RoundID = rm.ActiveRoundID
+
+	room := &Room{
+		Name:       name,
+		Unlisted:   cfg.Unlisted,
+		CreatedAt:  time.Now(),
+		Owner:      owner,
+		Store:      s,
+		Market:     engine,
+		Trading:    tradingService,
+		Hub:        hub,
+		Rounds:     rm,
+		Controller: NewRoundController(rm, hub),
+		Jobs: jobs.NewManager(DefaultJobTimeout, func(job models.Job) {
+			hub.Broadcast <- models.WSMessage{
+				Event: "job_updated",
+				Data:  job,
+			}
+		}),
+	}
+
+	// Nothing can fail past this point, so the goroutines of the room only
+	// start now.
+	go hub.Run()
+	tradingService.Start()
+	return room, nil
+}
+
+// GetRoom returns the room with the given name.
+func GetRoom(name string) (*Room, bool) {
+	roomsMu.RLock()
+	defer roomsMu.RUnlock()
+
+	room, ok := rooms[name]
+	return room, ok
+}
+
+// ListRooms returns every room sorted by name.
+func ListRooms() []*Room {
+	roomsMu.RLock()
+	defer roomsMu.RUnlock()
+
+	out := make([]*Room, 0, len(rooms))
+	for _, room := range rooms {
+		out = append(out, room)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+const roomKey = "room"
+
+// RoomMiddleware resolves the room named by the "room" query parameter,
+// defaulting to DefaultRoom, and makes it available to handlers through
+// RoomFrom.
+func RoomMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.DefaultQuery("room", DefaultRoom)
+		room, ok := GetRoom(name)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "room not found"})
+			return
+		}
+		c.Set(roomKey, room)
+		c.Next()
+	}
+}
+
+// RoomFrom returns the room resolved by RoomMiddleware.
+func RoomFrom(c *gin.Context) *Room {
+	return c.MustGet(roomKey).(*Room)
+}
+
+// RoundHandler adapts a RoundController method to the room of each request.
+func RoundHandler(handler func(*RoundController, *gin.Context)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		handler(RoomFrom(c).Controller, c)
+	}
+}
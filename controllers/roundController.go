@@ -2,11 +2,14 @@
 package controllers
 
 import (
+	"context"
 	"net/http"
 	"strconv"
 	"time"
 
 	"midnight-trader/models"
+	"midnight-trader/store"
+	"midnight-trader/trading"
 
 	"github.com/gin-gonic/gin"
 )
@@ -25,34 +28,29 @@ func NewRoundController(rm *RoundManagerWrapper, hub *models.Hub) *RoundControll
 	}
 }
 
-// StartRound initializes a new round.
+// StartRound starts the next round now, skipping the rest of its lobby.
+// The manager methods take RoundLock themselves, so it must not be held here.
 func (rc *RoundController) StartRound(c *gin.Context) {
-	rc.RoundManager.RoundLock.Lock()
-	defer rc.RoundManager.RoundLock.Unlock()
-
-	if rc.RoundManager.CurrentRound != nil && rc.RoundManager.CurrentRound.Status == "active" {
+	if current := rc.RoundManager.GetCurrentRound(); current != nil && current.Status == "active" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "A round is already active."})
 		return
 	}
 
-	rc.RoundManager.StartNextRound()
+	rc.RoundManager.StartNow()
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Round started.",
-		"round":   rc.RoundManager.CurrentRound,
+		"round":   rc.RoundManager.GetCurrentRound(),
 	})
 }
 
 // EndRound manually ends the current round.
 func (rc *RoundController) EndRound(c *gin.Context) {
-	rc.RoundManager.RoundLock.Lock()
-	defer rc.RoundManager.RoundLock.Unlock()
-
-	if rc.RoundManager.CurrentRound == nil || rc.RoundManager.CurrentRound.Status != "active" {
+	endedRound := rc.RoundManager.GetCurrentRound()
+	if endedRound == nil || endedRound.Status != "active" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No active round to end."})
 		return
 	}
 
-	endedRound := rc.RoundManager.CurrentRound
 	rc.RoundManager.EndRound()
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Round ended.",
@@ -62,12 +60,9 @@ func (rc *RoundController) EndRound(c *gin.Context) {
 
 // EndRoundAutomatically is called (by timer) to end the round.
 func (rc *RoundController) EndRoundAutomatically(roundID int) {
-	rc.RoundManager.RoundLock.Lock()
-	defer rc.RoundManager.RoundLock.Unlock()
-
-	if rc.RoundManager.CurrentRound != nil &&
-		rc.RoundManager.CurrentRound.Status == "active" &&
-		rc.RoundManager.CurrentRound.ID == roundID {
+	if current := rc.RoundManager.GetCurrentRound(); current != nil &&
+		current.Status == "active" &&
+		current.ID == roundID {
 		rc.RoundManager.EndRound()
 	}
 }
@@ -81,51 +76,70 @@ func (rc *RoundController) GetRoundStatus(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "No round in progress."})
 		return
 	}
+	rc.RoundManager.refreshParticipants()
 	c.JSON(http.StatusOK, gin.H{"round": rc.RoundManager.CurrentRound})
 }
 
-// JoinRound allows a player to join an active round.
+// JoinRound allows a player to join the lobby or an active round. Joining
+// resets the player's portfolio so everyone starts the round on equal terms.
+// Trading calls tag events with the round ID, which takes RoundLock, so the
+// lock is released around them.
 func (rc *RoundController) JoinRound(c *gin.Context) {
-	player := c.Query("player")
-	if player == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Player parameter is required."})
-		return
-	}
+	player := CurrentPlayer(c)
 
 	rc.RoundManager.RoundLock.Lock()
-	defer rc.RoundManager.RoundLock.Unlock()
-
-	if rc.RoundManager.CurrentRound == nil || rc.RoundManager.CurrentRound.Status != "active" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No active round to join."})
+	if rc.RoundManager.CurrentRound == nil || rc.RoundManager.CurrentRound.Status == "ended" {
+		rc.RoundManager.RoundLock.Unlock()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No open round to join."})
 		return
 	}
 
 	// Check for duplicate join
-	for _, p := range rc.RoundManager.CurrentRound.Participants {
-		if p.Player == player {
-			c.JSON(http.StatusOK, gin.H{
-				"message": "Player already joined.",
-				"round":   rc.RoundManager.CurrentRound,
-			})
-			return
-		}
+	if rc.RoundManager.participantIndex(player) >= 0 {
+		round := rc.RoundManager.CurrentRound
+		rc.RoundManager.RoundLock.Unlock()
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Player already joined.",
+			"round":   round,
+		})
+		return
+	}
+	roundID := rc.RoundManager.CurrentRound.ID
+	rc.RoundManager.RoundLock.Unlock()
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	newParticipant, err := rc.RoundManager.Trading.ResetPortfolio(ctx, player)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	newParticipant := models.Portfolio{
-		Player:    player,
-		Companies: make(map[string]int),
-		Funds:     1000.0,
+	rc.RoundManager.RoundLock.Lock()
+	defer rc.RoundManager.RoundLock.Unlock()
+
+	// The round may have ended, or the player joined twice, while unlocked.
+	if rc.RoundManager.CurrentRound == nil || rc.RoundManager.CurrentRound.ID != roundID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No open round to join."})
+		return
+	}
+	if rc.RoundManager.participantIndex(player) < 0 {
+		rc.RoundManager.CurrentRound.Participants = append(rc.RoundManager.CurrentRound.Participants, *newParticipant)
+		rc.RoundManager.saveRound()
 	}
-	rc.RoundManager.CurrentRound.Participants = append(rc.RoundManager.CurrentRound.Participants, newParticipant)
 
 	// Broadcast that a player has joined.
 	rc.Hub.Broadcast <- models.WSMessage{
 		Event: "player_joined",
 		Data: gin.H{
-			"round_id": rc.RoundManager.CurrentRound.ID,
+			"round_id": roundID,
 			"player":   newParticipant,
 		},
 	}
+	if rc.RoundManager.CurrentRound.Status == "lobby" {
+		rc.RoundManager.broadcastLobby()
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Player joined the round.",
@@ -133,6 +147,65 @@ func (rc *RoundController) JoinRound(c *gin.Context) {
 	})
 }
 
+// SetReady marks a player in the lobby as ready (or not, with ready=false).
+func (rc *RoundController) SetReady(c *gin.Context) {
+	player := CurrentPlayer(c)
+	ready := c.DefaultQuery("ready", "true") != "false"
+
+	round, err := rc.RoundManager.SetReady(player, ready)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Ready state updated.",
+		"round":   round,
+	})
+}
+
+// GetRoundsHandler lists past and current rounds, newest first.
+func GetRoundsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		rounds, err := RoomFrom(c).Store.ListRounds(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, rounds)
+	}
+}
+
+// GetRoundHandler returns a single round by ID.
+func GetRoundHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid round ID."})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		round, err := RoomFrom(c).Store.GetRound(ctx, id)
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Round not found."})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, round)
+	}
+}
+
 // RoundTimer returns the elapsed and remaining time for the round.
 func (rc *RoundController) RoundTimer(c *gin.Context) {
 	rc.RoundManager.RoundLock.Lock()
@@ -154,125 +227,79 @@ func (rc *RoundController) RoundTimer(c *gin.Context) {
 	})
 }
 
-// UpdatePortfolio processes portfolio adjustments (buy/sell/funds).
+// UpdatePortfolio processes portfolio adjustments (buy/sell/remove funds)
+// through the trading service, which also broadcasts the resulting events.
+// Players can't add funds to their own portfolio.
 func (rc *RoundController) UpdatePortfolio(c *gin.Context) {
-	player := c.Query("player")
-	action := c.Query("action")    // "buy", "sell", "add_funds", "remove_funds"
+	player := CurrentPlayer(c)
+	action := c.Query("action")    // "buy", "sell", "remove_funds"
 	company := c.Query("company")  // for buy/sell
 	sharesStr := c.Query("shares") // used for buy/sell
 	amountStr := c.Query("amount") // used for funds
 
-	if player == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Player parameter is required."})
-		return
-	}
-
 	rc.RoundManager.RoundLock.Lock()
-	defer rc.RoundManager.RoundLock.Unlock()
-
 	if rc.RoundManager.CurrentRound == nil || rc.RoundManager.CurrentRound.Status != "active" {
+		rc.RoundManager.RoundLock.Unlock()
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No active round."})
 		return
 	}
-
-	// Locate the participant.
-	idx := -1
-	for i, p := range rc.RoundManager.CurrentRound.Participants {
-		if p.Player == player {
-			idx = i
-			break
-		}
-	}
-	if idx == -1 {
+	if rc.RoundManager.participantIndex(player) < 0 {
+		rc.RoundManager.RoundLock.Unlock()
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Player not found in current round."})
 		return
 	}
+	rc.RoundManager.RoundLock.Unlock()
 
-	participant := &rc.RoundManager.CurrentRound.Participants[idx]
-	switch action {
-	case "buy":
-		if company == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Company parameter is required for buying."})
-			return
-		}
-		shares, err := strconv.Atoi(sharesStr)
-		if err != nil || shares <= 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Valid shares parameter is required."})
-			return
-		}
-
-		price := rc.RoundManager.GetCompanyPrice(company)
-		totalCost := float64(shares) * price
-		if participant.Funds < totalCost {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient funds."})
-			return
-		}
-
-		participant.Funds -= totalCost
-		participant.Companies[company] += shares
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
 
-	case "sell":
+	var portfolio *models.Portfolio
+	var err error
+	switch action {
+	case "buy", "sell":
 		if company == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Company parameter is required for selling."})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Company parameter is required for " + action + "ing."})
 			return
 		}
-		shares, err := strconv.Atoi(sharesStr)
-		if err != nil || shares <= 0 {
+		shares, convErr := strconv.Atoi(sharesStr)
+		if convErr != nil || shares <= 0 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Valid shares parameter is required."})
 			return
 		}
-		currentShares, exists := participant.Companies[company]
-		if !exists || currentShares < shares {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient shares."})
-			return
-		}
-
-		price := rc.RoundManager.GetCompanyPrice(company)
-		totalGain := float64(shares) * price
-		participant.Funds += totalGain
-		participant.Companies[company] -= shares
-		if participant.Companies[company] == 0 {
-			delete(participant.Companies, company)
-		}
-
-	case "add_funds":
-		amount, err := strconv.ParseFloat(amountStr, 64)
-		if err != nil || amount <= 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Valid amount parameter is required."})
-			return
-		}
-		participant.Funds += amount
+		_, portfolio, err = rc.RoundManager.Trading.Trade(ctx, player, company, action, shares)
 
 	case "remove_funds":
-		amount, err := strconv.ParseFloat(amountStr, 64)
-		if err != nil || amount <= 0 {
+		amount, convErr := strconv.ParseFloat(amountStr, 64)
+		if convErr != nil || amount <= 0 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Valid amount parameter is required."})
 			return
 		}
-		if participant.Funds < amount {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient funds."})
-			return
-		}
-		participant.Funds -= amount
+		portfolio, err = rc.RoundManager.Trading.AdjustFunds(ctx, player, -amount)
 
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action."})
 		return
 	}
 
-	// Broadcast portfolio update.
-	rc.Hub.Broadcast <- models.WSMessage{
-		Event: "portfolio_updated",
-		Data: gin.H{
-			"round_id":  rc.RoundManager.CurrentRound.ID,
-			"player":    participant.Player,
-			"companies": participant.Companies,
-			"funds":     participant.Funds,
-		},
+	if err == trading.ErrCompanyNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rc.RoundManager.RoundLock.Lock()
+	if rc.RoundManager.CurrentRound != nil {
+		if i := rc.RoundManager.participantIndex(player); i >= 0 {
+			rc.RoundManager.CurrentRound.Participants[i] = *portfolio
+		}
 	}
+	rc.RoundManager.RoundLock.Unlock()
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":   "Portfolio updated.",
-		"portfolio": participant,
+		"portfolio": portfolio,
 	})
 }
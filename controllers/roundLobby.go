@@ -0,0 +1,200 @@
+// controllers/roundLobby.go
+package controllers
+
+import (
+	"errors"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"midnight-trader/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrNoLobby          = errors.New("no lobby is open")
+	ErrNotInLobby       = errors.New("player has not joined the lobby")
+	ErrCountdownStarted = errors.New("the round is already counting down")
+)
+
+// openLobby creates the next round in the "lobby" state. The round starts
+// after a countdown once at least MinPlayers have joined and either everyone
+// is ready or the lobby window has passed. Callers must hold RoundLock.
+func (rm *RoundManagerWrapper) openLobby() {
+	rm.stopTimers()
+
+	rm.CurrentRound = &models.RoundState{
+		ID:           rm.generateRoundID(),
+		Status:       "lobby",
+		Participants: []models.Portfolio{},
+		Ready:        make(map[string]bool),
+		LobbyEndsAt:  time.Now().Add(rm.LobbyDuration),
+	}
+
+	roundID := rm.CurrentRound.ID
+	rm.Timer = time.AfterFunc(rm.LobbyDuration, func() {
+		rm.lobbyExpired(roundID)
+	})
+
+	rm.Hub.Broadcast <- models.WSMessage{
+		Event: "lobby_opened",
+		Data: gin.H{
+			"round_id":    roundID,
+			"min_players": rm.MinPlayers,
+			"lobby_ends":  rm.CurrentRound.LobbyEndsAt.UTC().String(),
+		},
+	}
+	log.Printf("Lobby for round %d opened.", roundID)
+}
+
+// lobbyExpired runs when the lobby window passes. With enough players the
+// countdown starts; otherwise the lobby stays open for another window.
+func (rm *RoundManagerWrapper) lobbyExpired(roundID int) {
+	rm.RoundLock.Lock()
+	defer rm.RoundLock.Unlock()
+
+	if !rm.inLobby(roundID) || !rm.CurrentRound.StartsAt.IsZero() {
+		return
+	}
+
+	if len(rm.CurrentRound.Participants) >= rm.MinPlayers {
+		rm.startCountdown()
+		return
+	}
+
+	rm.CurrentRound.LobbyEndsAt = time.Now().Add(rm.LobbyDuration)
+	rm.Timer = time.AfterFunc(rm.LobbyDuration, func() {
+		rm.lobbyExpired(roundID)
+	})
+	rm.broadcastLobby()
+}
+
+// SetReady marks a lobby participant as ready or not. When every participant
+// is ready and there are at least MinPlayers, the countdown starts at once.
+// It returns a snapshot of the lobby that is safe to use without RoundLock.
+func (rm *RoundManagerWrapper) SetReady(player string, ready bool) (*models.RoundState, error) {
+	rm.RoundLock.Lock()
+	defer rm.RoundLock.Unlock()
+
+	if rm.CurrentRound == nil || rm.CurrentRound.Status != "lobby" {
+		return nil, ErrNoLobby
+	}
+	if rm.participantIndex(player) < 0 {
+		return nil, ErrNotInLobby
+	}
+	if !rm.CurrentRound.StartsAt.IsZero() {
+		return nil, ErrCountdownStarted
+	}
+
+	rm.CurrentRound.Ready[player] = ready
+	rm.broadcastLobby()
+
+	if rm.allReady() {
+		rm.startCountdown()
+	}
+
+	round := *rm.CurrentRound
+	round.Participants = slices.Clone(round.Participants)
+	round.Ready = maps.Clone(round.Ready)
+	return &round, nil
+}
+
+// allReady reports whether the lobby has enough players and all of them are
+// ready. Callers must hold RoundLock.
+func (rm *RoundManagerWrapper) allReady() bool {
+	participants := rm.CurrentRound.Participants
+	if len(participants) == 0 || len(participants) < rm.MinPlayers {
+		return false
+	}
+	for _, p := range participants {
+		if !rm.CurrentRound.Ready[p.Player] {
+			return false
+		}
+	}
+	return true
+}
+
+// startCountdown broadcasts a countdown and starts the round when it ends.
+// Players may still join during the countdown. Callers must hold RoundLock.
+func (rm *RoundManagerWrapper) startCountdown() {
+	rm.stopTimers()
+
+	roundID := rm.CurrentRound.ID
+	rm.CurrentRound.StartsAt = time.Now().Add(rm.CountdownDuration)
+	rm.Timer = time.AfterFunc(rm.CountdownDuration, func() {
+		rm.beginRound(roundID)
+	})
+
+	rm.TimerStopChan = make(chan struct{})
+	rm.TimerTicker = time.NewTicker(1 * time.Second)
+	go rm.sendCountdown(rm.TimerTicker, rm.TimerStopChan, roundID, rm.CurrentRound.StartsAt)
+
+	rm.broadcastCountdown(roundID, rm.CountdownDuration)
+	log.Printf("Round %d starts in %s.", roundID, rm.CountdownDuration)
+}
+
+// beginRound starts the round once its countdown has finished.
+func (rm *RoundManagerWrapper) beginRound(roundID int) {
+	rm.RoundLock.Lock()
+	defer rm.RoundLock.Unlock()
+
+	if rm.inLobby(roundID) {
+		rm.activate()
+	}
+}
+
+// sendCountdown broadcasts the time left before the round starts every
+// second until the countdown is stopped.
+func (rm *RoundManagerWrapper) sendCountdown(ticker *time.Ticker, stop chan struct{}, roundID int, startsAt time.Time) {
+	for {
+		select {
+		case <-ticker.C:
+			remaining := time.Until(startsAt)
+			if remaining < 0 {
+				remaining = 0
+			}
+			rm.broadcastCountdown(roundID, remaining)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (rm *RoundManagerWrapper) broadcastCountdown(roundID int, remaining time.Duration) {
+	rm.Hub.Broadcast <- models.WSMessage{
+		Event: "round_countdown",
+		Data: gin.H{
+			"round_id":  roundID,
+			"remaining": remaining.Round(time.Second).String(),
+		},
+	}
+}
+
+// broadcastLobby emits the "lobby_update" event with who has joined and who
+// is ready. Callers must hold RoundLock.
+func (rm *RoundManagerWrapper) broadcastLobby() {
+	players := make([]string, 0, len(rm.CurrentRound.Participants))
+	for _, p := range rm.CurrentRound.Participants {
+		players = append(players, p.Player)
+	}
+	rm.Hub.Broadcast <- models.WSMessage{
+		Event: "lobby_update",
+		Data: gin.H{
+			"round_id":    rm.CurrentRound.ID,
+			"players":     players,
+			"ready":       maps.Clone(rm.CurrentRound.Ready),
+			"min_players": rm.MinPlayers,
+			"lobby_ends":  rm.CurrentRound.LobbyEndsAt.UTC().String(),
+		},
+	}
+}
+
+// inLobby reports whether roundID is the current round and still in its
+// lobby. Callers must hold RoundLock.
+func (rm *RoundManagerWrapper) inLobby(roundID int) bool {
+	return rm.CurrentRound != nil &&
+		rm.CurrentRound.ID == roundID &&
+		rm.CurrentRound.Status == "lobby"
+}
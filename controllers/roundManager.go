@@ -3,33 +3,71 @@ package controllers
 
 import (
 	"log"
+	"math/rand/v2"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"context"
+	"midnight-trader/market"
 	"midnight-trader/models"
+	"midnight-trader/news"
+
+	"midnight-trader/store"
+	"midnight-trader/trading"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// CompanyCollection should be initialized elsewhere.
+const (
+	// DefaultTickInterval is how often prices move during an active round.
+	DefaultTickInterval = 2 * time.Second
+	// DefaultLobbyDuration is how long the lobby waits for players to ready up.
+	DefaultLobbyDuration = 30 * time.Second
+	// DefaultCountdownDuration is the countdown between a full lobby and the start.
+	DefaultCountdownDuration = 5 * time.Second
+	// DefaultMinPlayers is the number of players a round needs to start.
+	DefaultMinPlayers = 1
+	// DefaultNewsChance is the probability of a headline on each price tick.
+	DefaultNewsChance = 0.1
+)
 
 // RoundManagerWrapper is a local wrapper around models.RoundManager
-// which enables us to define new methods.
+// which enables us to define new methods. Each game room has its own.
 type RoundManagerWrapper struct {
 	models.RoundManager
+
+	Store   store.Store
+	Market  *market.Engine
+	Trading *trading.Service
+
+	// News writes the headlines published during a round, each price tick
+	// with probability NewsChance. Nil disables news.
+	News       news.Generator
+	NewsChance float64
+	newsBusy   atomic.Bool
+	// newsRNG draws which ticks get news, seeded like the market so that a
+	// room's seed replays the same news.
+	newsRNG *rand.Rand
+	newsMu  sync.Mutex
+
+	// lastRoundID is the ID given to the latest round, guarded by
+	// RoundLock.
+	lastRoundID int
 }
 
 // NewRoundManager creates a new RoundManagerWrapper instance.
 func NewRoundManager(hub *models.Hub, duration time.Duration, totalRounds int) *RoundManagerWrapper {
 	return &RoundManagerWrapper{
-		models.RoundManager{
-			Hub:           hub,
-			RoundDuration: duration,
-			TotalRounds:   totalRounds,
-			TimerStopChan: make(chan struct{}),
+		RoundManager: models.RoundManager{
+			Hub:               hub,
+			RoundDuration:     duration,
+			TotalRounds:       totalRounds,
+			TickInterval:      DefaultTickInterval,
+			LobbyDuration:     DefaultLobbyDuration,
+			CountdownDuration: DefaultCountdownDuration,
+			MinPlayers:        DefaultMinPlayers,
 		},
 	}
 }
@@ -39,7 +77,8 @@ func (rm *RoundManagerWrapper) Start() {
 	rm.StartNextRound()
 }
 
-// StartNextRound initiates the next round if conditions are met.
+// StartNextRound opens the lobby for the next round if conditions are met.
+// The round itself starts once the lobby fills up; see roundLobby.go.
 func (rm *RoundManagerWrapper) StartNextRound() {
 	rm.RoundLock.Lock()
 	defer rm.RoundLock.Unlock()
@@ -53,28 +92,55 @@ func (rm *RoundManagerWrapper) StartNextRound() {
 		return
 	}
 
-	if rm.CurrentRound != nil && rm.CurrentRound.Status == "active" {
-		log.Println("A round is already active.")
+	if rm.CurrentRound != nil {
+		log.Printf("Round %d is already %s.", rm.CurrentRound.ID, rm.CurrentRound.Status)
 		return
 	}
 
-	rm.CurrentRound = &models.RoundState{
-		ID:           rm.generateRoundID(),
-		Status:       "active",
-		StartTime:    time.Now(),
-		Participants: []models.Portfolio{},
+	rm.openLobby()
+}
+
+// StartNow skips the rest of the lobby and starts the round immediately,
+// opening a lobby first if none is open.
+func (rm *RoundManagerWrapper) StartNow() {
+	rm.RoundLock.Lock()
+	defer rm.RoundLock.Unlock()
+
+	if rm.CurrentRound == nil {
+		if rm.TotalRounds > 0 && rm.CompletedRounds >= rm.TotalRounds {
+			log.Println("All rounds completed.")
+			return
+		}
+		rm.openLobby()
+	}
+	if rm.CurrentRound.Status == "lobby" {
+		rm.activate()
 	}
+}
+
+// activate moves the lobby round into play. Callers must hold RoundLock.
+func (rm *RoundManagerWrapper) activate() {
+	rm.stopTimers()
+
+	rm.CurrentRound.Status = "active"
+	rm.CurrentRound.StartTime = time.Now()
+	rm.CurrentRound.Ready = nil
+	rm.CurrentRound.LobbyEndsAt = time.Time{}
+	rm.CurrentRound.StartsAt = time.Time{}
 
 	// Append historical data if necessary.
 	if err := rm.AppendGeneratedHistoricalData(); err != nil {
 		log.Println("Failed to append historical data:", err)
 	}
+	rm.CurrentRound.StartPrices = rm.snapshotPrices()
+	rm.saveRound()
 
 	rm.Hub.Broadcast <- models.WSMessage{
 		Event: "round_started",
 		Data: gin.H{
 			"round_id":   rm.CurrentRound.ID,
 			"start_time": rm.CurrentRound.StartTime.UTC().String(),
+			"players":    len(rm.CurrentRound.Participants),
 		},
 	}
 
@@ -84,15 +150,90 @@ func (rm *RoundManagerWrapper) StartNextRound() {
 	})
 
 	// Start ticker for periodic timer updates.
+	rm.TimerStopChan = make(chan struct{})
 	rm.TimerTicker = time.NewTicker(1 * time.Second)
-	go rm.sendTimerUpdates()
+	go rm.sendTimerUpdates(rm.TimerTicker, rm.TimerStopChan)
+
+	// Start ticker for intra-round price movement.
+	if rm.TickInterval > 0 {
+		rm.PriceTicker = time.NewTicker(rm.TickInterval)
+		go rm.tickPrices(rm.PriceTicker, rm.TimerStopChan)
+	}
 
 	log.Printf("Round %d started.", rm.CurrentRound.ID)
 }
 
-// AppendGeneratedHistoricalData is a placeholder; replace with your logic if needed.
+// stopTimers stops every timer and ticker of the current phase and signals
+// their goroutines to exit. Callers must hold RoundLock.
+func (rm *RoundManagerWrapper) stopTimers() {
+	if rm.Timer != nil {
+		rm.Timer.Stop()
+		rm.Timer = nil
+	}
+	if rm.TimerTicker != nil {
+		rm.TimerTicker.Stop()
+		rm.TimerTicker = nil
+	}
+	if rm.PriceTicker != nil {
+		rm.PriceTicker.Stop()
+		rm.PriceTicker = nil
+	}
+	if rm.TimerStopChan != nil {
+		close(rm.TimerStopChan)
+		rm.TimerStopChan = nil
+	}
+}
+
+// AppendGeneratedHistoricalData advances every company's price by one tick of
+// the market engine, persists the new prices and broadcasts them. The tick
+// starts from the stored prices and holds off trades at market until it is
+// persisted, so it never overwrites their price impact.
 func (rm *RoundManagerWrapper) AppendGeneratedHistoricalData() error {
-	return nil
+	if rm.Market == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return rm.Trading.MoveMarket(func() error {
+		companies, err := rm.Store.ListCompanies(ctx)
+		if err != nil {
+			return err
+		}
+		rm.Market.Sync(companies)
+
+		for ticker, price := range rm.Market.Step() {
+			if err := rm.Store.AppendCompanyPrices(ctx, ticker, []float64{price}); err != nil {
+				log.Printf("Failed to persist tick for %s: %v", ticker, err)
+				continue
+			}
+			rm.Trading.PublishPrice(ticker, price)
+		}
+		return nil
+	})
+}
+
+// tickPrices moves prices every TickInterval until the round ends, settles
+// margin positions at the new prices, snapshots every player's equity and
+// now and then publishes news.
+func (rm *RoundManagerWrapper) tickPrices(ticker *time.Ticker, stop chan struct{}) {
+	for {
+		select {
+		case <-ticker.C:
+			if err := rm.AppendGeneratedHistoricalData(); err != nil {
+				log.Println("Failed to tick prices:", err)
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			rm.Trading.MarginTick(ctx)
+			rm.snapshotEquity(ctx)
+			cancel()
+			rm.maybePublishNews()
+		case <-stop:
+			return
+		}
+	}
 }
 
 // EndRound manually ends the current round.
@@ -105,14 +246,10 @@ func (rm *RoundManagerWrapper) EndRound() {
 	}
 
 	// Stop timers.
-	if rm.Timer != nil {
-		rm.Timer.Stop()
-		rm.Timer = nil
-	}
-	if rm.TimerTicker != nil {
-		rm.TimerTicker.Stop()
-		rm.TimerTicker = nil
-	}
+	rm.stopTimers()
+
+	// Settle standings on the persisted portfolios.
+	rm.refreshParticipants()
 
 	// Debug: log each participant's portfolio value.
 	for i, p := range rm.CurrentRound.Participants {
@@ -131,8 +268,10 @@ func (rm *RoundManagerWrapper) EndRound() {
 	rm.CurrentRound.Status = "ended"
 	rm.CurrentRound.EndTime = time.Now()
 
-	// Compute leaderboard and broadcast leaderboard update.
-	leaderboard := rm.GetLeaderboard()
+	// Compute the final leaderboard and keep it with the round history.
+	rm.CurrentRound.Leaderboard = rm.standings()
+	rm.CurrentRound.EndPrices = rm.snapshotPrices()
+	rm.saveRound()
 
 	rm.Hub.Broadcast <- models.WSMessage{
 		Event: "round_ended",
@@ -140,7 +279,7 @@ func (rm *RoundManagerWrapper) EndRound() {
 			"round_id":    rm.CurrentRound.ID,
 			"end_time":    rm.CurrentRound.EndTime.UTC().String(),
 			"winner":      rm.CurrentRound.Winner,
-			"leaderboard": leaderboard,
+			"leaderboard": rm.CurrentRound.Leaderboard,
 		},
 	}
 
@@ -159,10 +298,10 @@ func (rm *RoundManagerWrapper) EndRoundAutomatically() {
 }
 
 // sendTimerUpdates sends periodic timer updates to clients.
-func (rm *RoundManagerWrapper) sendTimerUpdates() {
+func (rm *RoundManagerWrapper) sendTimerUpdates(ticker *time.Ticker, stop chan struct{}) {
 	for {
 		select {
-		case <-rm.TimerTicker.C:
+		case <-ticker.C:
 			rm.RoundLock.Lock()
 			if rm.CurrentRound == nil || rm.CurrentRound.Status != "active" {
 				rm.RoundLock.Unlock()
@@ -184,15 +323,30 @@ func (rm *RoundManagerWrapper) sendTimerUpdates() {
 					"remaining": remaining.String(),
 				},
 			}
-		case <-rm.TimerStopChan:
+		case <-stop:
 			return
 		}
 	}
 }
 
-// generateRoundID returns a unique round ID.
+// generateRoundID returns a round ID no earlier round of the room has used:
+// the current Unix time, or one more than the latest ID if that is later.
+// Callers must hold RoundLock.
 func (rm *RoundManagerWrapper) generateRoundID() int {
-	return int(time.Now().Unix())
+	if rm.lastRoundID == 0 && rm.Store != nil {
+		// Pick up where the stored rounds left off before the restart.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		rounds, err := rm.Store.ListRounds(ctx)
+		if err != nil {
+			log.Printf("Failed to load past rounds: %v", err)
+		}
+		for _, round := range rounds {
+			rm.lastRoundID = max(rm.lastRoundID, round.ID)
+		}
+	}
+	rm.lastRoundID = max(int(time.Now().Unix()), rm.lastRoundID+1)
+	return rm.lastRoundID
 }
 
 // determineWinner returns the participant with the highest portfolio value.
@@ -216,14 +370,45 @@ func (rm *RoundManagerWrapper) determineWinner() *models.Portfolio {
 	return winner
 }
 
-// calculatePortfolioValue calculates the total value of a participant's portfolio.
+// calculatePortfolioValue calculates the net equity of a participant's
+// portfolio: holdings at current prices minus short positions and any margin
+// loan, so leaderboards never reward borrowed money.
 func (rm *RoundManagerWrapper) calculatePortfolioValue(p models.Portfolio) float64 {
-	total := p.Funds
-	for ticker, shares := range p.Companies {
-		price := rm.GetCompanyPrice(ticker)
-		total += float64(shares) * price
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return rm.Trading.PortfolioValue(ctx, p)
+}
+
+// participantIndex returns the index of player in the current round, or -1.
+// Callers must hold RoundLock.
+func (rm *RoundManagerWrapper) participantIndex(player string) int {
+	for i, p := range rm.CurrentRound.Participants {
+		if p.Player == player {
+			return i
+		}
+	}
+	return -1
+}
+
+// refreshParticipants replaces each participant with their persisted
+// portfolio, so standings reflect trades made through any endpoint.
+// Callers must hold RoundLock.
+func (rm *RoundManagerWrapper) refreshParticipants() {
+	if rm.CurrentRound == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i, p := range rm.CurrentRound.Participants {
+		portfolio, err := rm.Store.GetPortfolio(ctx, p.Player)
+		if err != nil {
+			log.Printf("Failed to refresh portfolio for %s: %v", p.Player, err)
+			continue
+		}
+		rm.CurrentRound.Participants[i] = *portfolio
 	}
-	return total
 }
 
 // GetCompanyPrice retrieves the current price of a company by its ticker.
@@ -240,21 +425,19 @@ func (rm *RoundManagerWrapper) GetCompanyPrice(ticker string) float64 {
 	return company.StockPrice
 }
 
-// GetCompanyByTicker retrieves a company by ticker from MongoDB.
+// GetCompanyByTicker retrieves a company by ticker from the store.
 func (rm *RoundManagerWrapper) GetCompanyByTicker(ticker string) (*models.Company, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	filter := bson.M{"ticker": ticker}
-	var company models.Company
-	err := CompanyCollection.FindOne(ctx, filter).Decode(&company)
+	company, err := rm.Store.GetCompany(ctx, ticker)
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, nil
-		}
 		return nil, err
 	}
-	return &company, nil
+	return company, nil
 }
 
 // GetCurrentRound provides thread-safe access to the current round.
@@ -270,6 +453,15 @@ func (rm *RoundManagerWrapper) GetLeaderboard() []models.Portfolio {
 	// an existing Lock, otherwise consider removing additional locking.
 	rm.RoundLock.Lock()
 	defer rm.RoundLock.Unlock()
+	return rm.leaderboard()
+}
+
+// leaderboard is GetLeaderboard for callers that already hold RoundLock.
+func (rm *RoundManagerWrapper) leaderboard() []models.Portfolio {
+	if rm.CurrentRound == nil {
+		return nil
+	}
+	rm.refreshParticipants()
 
 	// Make a copy of the participants to avoid modifying the original slice.
 	leaderboard := make([]models.Portfolio, len(rm.CurrentRound.Participants))
@@ -281,13 +473,74 @@ func (rm *RoundManagerWrapper) GetLeaderboard() []models.Portfolio {
 	return leaderboard
 }
 
-// Global instance for accessing the RoundManagerWrapper from anywhere.
-var CurrentRoundManager *RoundManagerWrapper
+// ActiveRoundID returns the ID of the active round, or 0 when there is none.
+func (rm *RoundManagerWrapper) ActiveRoundID() int {
+	rm.RoundLock.Lock()
+	defer rm.RoundLock.Unlock()
 
-// GetCurrentRound returns the current round from the active round manager.
-func GetCurrentRound() *models.RoundState {
-	if CurrentRoundManager == nil {
+	if rm.CurrentRound == nil || rm.CurrentRound.Status != "active" {
+		return 0
+	}
+	return rm.CurrentRound.ID
+}
+
+// standings ranks the current round's participants by portfolio value.
+// Callers must hold RoundLock.
+func (rm *RoundManagerWrapper) standings() []models.Standing {
+	if rm.CurrentRound == nil {
 		return nil
 	}
-	return CurrentRoundManager.GetCurrentRound()
+	rm.refreshParticipants()
+
+	standings := make([]models.Standing, 0, len(rm.CurrentRound.Participants))
+	for _, p := range rm.CurrentRound.Participants {
+		standings = append(standings, models.Standing{
+			Player:         p.Player,
+			Value:          rm.calculatePortfolioValue(p),
+			Funds:          p.Funds,
+			Loan:           p.Loan,
+			Companies:      p.Companies,
+			ReservedFunds:  p.ReservedFunds,
+			ReservedShares: p.ReservedShares,
+		})
+	}
+	sort.SliceStable(standings, func(i, j int) bool {
+		return standings[i].Value > standings[j].Value
+	})
+	for i := range standings {
+		standings[i].Rank = i + 1
+	}
+	return standings
+}
+
+// snapshotPrices returns the current stock price of every company.
+func (rm *RoundManagerWrapper) snapshotPrices() map[string]float64 {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	companies, err := rm.Store.ListCompanies(ctx)
+	if err != nil {
+		log.Println("Failed to snapshot prices:", err)
+		return nil
+	}
+	prices := make(map[string]float64, len(companies))
+	for _, c := range companies {
+		prices[c.Ticker] = c.StockPrice
+	}
+	return prices
+}
+
+// saveRound persists the current round. Rounds are only recorded once they
+// leave the lobby. Callers must hold RoundLock.
+func (rm *RoundManagerWrapper) saveRound() {
+	if rm.CurrentRound == nil || rm.CurrentRound.Status == "lobby" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := rm.Store.SaveRound(ctx, *rm.CurrentRound); err != nil {
+		log.Printf("Failed to save round %d: %v", rm.CurrentRound.ID, err)
+	}
 }
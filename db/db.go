@@ -62,3 +62,12 @@ func GetDB() *mongo.Database {
 	}
 	return Client.Database("midnight_trader")
 }
+
+// GetRoomDB returns the database holding the data of a game room other than
+// the default one.
+func GetRoomDB(room string) *mongo.Database {
+	if Client == nil {
+		log.Fatal("MongoDB client not initialized")
+	}
+	return Client.Database("midnight_trader_room_" + room)
+}
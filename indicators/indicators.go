@@ -0,0 +1,183 @@
+// Package indicators computes technical indicators over price series for the
+// trading screen.
+package indicators
+
+import (
+	"math"
+	"strconv"
+)
+
+// Default parameters of the indicators.
+const (
+	DefaultPeriod    = 20 // SMA, EMA and Bollinger Bands
+	DefaultRSIPeriod = 14
+	MACDFast         = 12
+	MACDSlow         = 26
+	MACDSignal       = 9
+	BollingerWidth   = 2 // standard deviations
+)
+
+// Series holds one indicator value per input value. Values the indicator
+// doesn't have enough input for yet are NaN, which encodes as JSON null.
+type Series []float64
+
+func (s Series) MarshalJSON() ([]byte, error) {
+	buf := make([]byte, 0, 2+len(s)*8)
+	buf = append(buf, '[')
+	for i, v := range s {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			buf = append(buf, "null"...)
+		} else {
+			buf = strconv.AppendFloat(buf, v, 'f', -1, 64)
+		}
+	}
+	return append(buf, ']'), nil
+}
+
+// Last returns the last value of s, or nil if there is none yet.
+func (s Series) Last() *float64 {
+	if len(s) == 0 || math.IsNaN(s[len(s)-1]) {
+		return nil
+	}
+	v := s[len(s)-1]
+	return &v
+}
+
+func nans(n int) Series {
+	s := make(Series, n)
+	for i := range s {
+		s[i] = math.NaN()
+	}
+	return s
+}
+
+// SMA is the simple moving average of the last period values.
+func SMA(values []float64, period int) Series {
+	out := nans(len(values))
+	if period <= 0 {
+		return out
+	}
+	sum := 0.0
+	for i, v := range values {
+		sum += v
+		if i >= period {
+			sum -= values[i-period]
+		}
+		if i >= period-1 {
+			out[i] = sum / float64(period)
+		}
+	}
+	return out
+}
+
+// EMA is the exponential moving average with smoothing 2/(period+1), seeded
+// with the SMA of its first period values. Leading NaNs in values, such as
+// the warm-up of another indicator, are skipped.
+func EMA(values []float64, period int) Series {
+	out := nans(len(values))
+	start := 0
+	for start < len(values) && math.IsNaN(values[start]) {
+		start++
+	}
+	if period <= 0 || len(values)-start < period {
+		return out
+	}
+
+	seed := 0.0
+	for _, v := range values[start : start+period] {
+		seed += v
+	}
+	i := start + period - 1
+	out[i] = seed / float64(period)
+	alpha := 2 / float64(period+1)
+	for i++; i < len(values); i++ {
+		out[i] = alpha*values[i] + (1-alpha)*out[i-1]
+	}
+	return out
+}
+
+// RSI is the relative strength index with Wilder's smoothing, between 0 and
+// 100.
+func RSI(values []float64, period int) Series {
+	out := nans(len(values))
+	if period <= 0 || len(values) <= period {
+		return out
+	}
+
+	gain, loss := 0.0, 0.0
+	for i := 1; i <= period; i++ {
+		change := values[i] - values[i-1]
+		gain += math.Max(change, 0)
+		loss += math.Max(-change, 0)
+	}
+	gain /= float64(period)
+	loss /= float64(period)
+	out[period] = rsi(gain, loss)
+	for i := period + 1; i < len(values); i++ {
+		change := values[i] - values[i-1]
+		gain = (gain*float64(period-1) + math.Max(change, 0)) / float64(period)
+		loss = (loss*float64(period-1) + math.Max(-change, 0)) / float64(period)
+		out[i] = rsi(gain, loss)
+	}
+	return out
+}
+
+func rsi(gain, loss float64) float64 {
+	if loss == 0 {
+		if gain == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100 - 100/(1+gain/loss)
+}
+
+// MACD returns the difference between the fast and slow EMA, its signal EMA
+// and the histogram of the two.
+func MACD(values []float64, fast, slow, signal int) (line, signalLine, histogram Series) {
+	fastEMA, slowEMA := EMA(values, fast), EMA(values, slow)
+	line = make(Series, len(values))
+	for i := range values {
+		line[i] = fastEMA[i] - slowEMA[i]
+	}
+	signalLine = EMA(line, signal)
+	histogram = make(Series, len(values))
+	for i := range values {
+		histogram[i] = line[i] - signalLine[i]
+	}
+	return line, signalLine, histogram
+}
+
+// Bollinger returns the SMA of period values and the bands width standard
+// deviations above and below it.
+func Bollinger(values []float64, period int, width float64) (middle, upper, lower Series) {
+	middle = SMA(values, period)
+	upper, lower = nans(len(values)), nans(len(values))
+	for i := period - 1; i >= 0 && i < len(values); i++ {
+		variance := 0.0
+		for _, v := range values[i-period+1 : i+1] {
+			variance += (v - middle[i]) * (v - middle[i])
+		}
+		deviation := math.Sqrt(variance / float64(period))
+		upper[i] = middle[i] + width*deviation
+		lower[i] = middle[i] - width*deviation
+	}
+	return middle, upper, lower
+}
+
+// VWAP is the volume-weighted average price from the first value on.
+func VWAP(prices, volumes []float64) Series {
+	out := nans(len(prices))
+	value, volume := 0.0, 0.0
+	for i, p := range prices {
+		value += p * volumes[i]
+		volume += volumes[i]
+		if volume > 0 {
+			out[i] = value / volume
+		}
+	}
+	return out
+}
@@ -0,0 +1,112 @@
+package indicators
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"midnight-trader/models"
+)
+
+var testValues = []float64{1, 2, 3, 4, 5, 4, 3, 4, 5, 6}
+
+var nan = math.NaN()
+
+func assertSeries(t *testing.T, name string, got Series, want []float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s has %d values, want %d", name, len(got), len(want))
+	}
+	for i, w := range want {
+		if math.IsNaN(w) != math.IsNaN(got[i]) || !math.IsNaN(w) && math.Abs(got[i]-w) > 1e-3 {
+			t.Errorf("%s[%d] = %v, want %v", name, i, got[i], w)
+		}
+	}
+}
+
+func TestSMA(t *testing.T) {
+	assertSeries(t, "SMA", SMA(testValues, 3), []float64{nan, nan, 2, 3, 4, 4.333, 4, 3.667, 4, 5})
+}
+
+func TestEMA(t *testing.T) {
+	// Seeded with the SMA of 2, then half of each new value.
+	assertSeries(t, "EMA", EMA(testValues, 3), []float64{nan, nan, 2, 3, 4, 4, 3.5, 3.75, 4.375, 5.1875})
+
+	// The warm-up of another indicator is skipped.
+	assertSeries(t, "EMA", EMA([]float64{nan, 2, 4, 6}, 2), []float64{nan, nan, 3, 5})
+}
+
+func TestRSI(t *testing.T) {
+	assertSeries(t, "RSI", RSI(testValues, 3), []float64{nan, nan, nan, 100, 100, 66.667, 44.444, 62.963, 75.309, 83.539})
+	assertSeries(t, "RSI", RSI([]float64{5, 5, 5}, 2), []float64{nan, nan, 50})
+}
+
+func TestMACD(t *testing.T) {
+	// The 2 period EMA is 1.5, 2.5, 3.5, 4.5, 4.167, 3.389, 3.796, 4.599 and
+	// 5.533 from the second value on.
+	line, signal, histogram := MACD(testValues, 2, 3, 2)
+	assertSeries(t, "MACD", line, []float64{nan, nan, 0.5, 0.5, 0.5, 0.167, -0.111, 0.046, 0.224, 0.345})
+	assertSeries(t, "signal", signal, []float64{nan, nan, nan, 0.5, 0.5, 0.278, 0.019, 0.037, 0.162, 0.284})
+	assertSeries(t, "histogram", histogram, []float64{nan, nan, nan, 0, 0, -0.111, -0.130, 0.009, 0.062, 0.061})
+}
+
+func TestBollinger(t *testing.T) {
+	// Population standard deviation: 0.816 for 1, 2, 3 and 0.471 for 4, 5, 4.
+	middle, upper, lower := Bollinger(testValues, 3, 2)
+	assertSeries(t, "middle", middle, SMA(testValues, 3))
+	assertSeries(t, "upper", upper, []float64{nan, nan, 3.633, 4.633, 5.633, 5.276, 5.633, 4.609, 5.633, 6.633})
+	assertSeries(t, "lower", lower, []float64{nan, nan, 0.367, 1.367, 2.367, 3.391, 2.367, 2.724, 2.367, 3.367})
+}
+
+func TestVWAP(t *testing.T) {
+	volumes := []float64{0, 0, 1, 1, 1, 1, 1, 1, 1, 1}
+	assertSeries(t, "VWAP", VWAP(testValues, volumes), []float64{nan, nan, 3, 3.5, 4, 4, 3.8, 3.833, 4, 4.25})
+}
+
+func TestSeriesJSON(t *testing.T) {
+	data, err := json.Marshal(Series{nan, 1.5, math.Inf(1), 2})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if got := string(data); got != "[null,1.5,null,2]" {
+		t.Errorf("got %s, want [null,1.5,null,2]", got)
+	}
+}
+
+func TestLast(t *testing.T) {
+	if v := (Series{1, 2}).Last(); v == nil || *v != 2 {
+		t.Errorf("Last = %v, want 2", v)
+	}
+	if v := (Series{1, nan}).Last(); v != nil {
+		t.Errorf("Last = %v, want nil while warming up", *v)
+	}
+	if v := (Series{}).Last(); v != nil {
+		t.Errorf("Last of an empty series = %v, want nil", *v)
+	}
+}
+
+func TestSetLatest(t *testing.T) {
+	candles := make([]models.Candle, len(testValues))
+	for i, v := range testValues {
+		candles[i] = models.Candle{Open: v, High: v, Low: v, Close: v, Volume: 1}
+	}
+	latest := FromCandles(candles, 3, 3).Latest()
+	for _, c := range []struct {
+		name string
+		got  *float64
+		want float64
+	}{
+		{"SMA", latest.SMA, 5},
+		{"EMA", latest.EMA, 5.1875},
+		{"RSI", latest.RSI, 83.539},
+		{"VWAP", latest.VWAP, 3.7},
+	} {
+		if c.got == nil || math.Abs(*c.got-c.want) > 1e-3 {
+			t.Errorf("latest %s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+	// 10 closes are too few for the 26 period EMA of the MACD.
+	if latest.MACD != nil {
+		t.Errorf("latest MACD = %v, want none while warming up", *latest.MACD)
+	}
+}
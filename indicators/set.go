@@ -0,0 +1,119 @@
+package indicators
+
+import (
+	"time"
+
+	"midnight-trader/models"
+)
+
+// Set is every indicator computed over a series of candles, aligned with
+// Time.
+type Set struct {
+	Time      []time.Time `json:"time"`
+	Close     Series      `json:"close"`
+	Volume    []int       `json:"volume"`
+	SMA       Series      `json:"sma"`
+	EMA       Series      `json:"ema"`
+	RSI       Series      `json:"rsi"`
+	MACD      MACDSet     `json:"macd"`
+	Bollinger BandSet     `json:"bollinger"`
+	VWAP      Series      `json:"vwap"`
+}
+
+type MACDSet struct {
+	MACD      Series `json:"macd"`
+	Signal    Series `json:"signal"`
+	Histogram Series `json:"histogram"`
+}
+
+type BandSet struct {
+	Middle Series `json:"middle"`
+	Upper  Series `json:"upper"`
+	Lower  Series `json:"lower"`
+}
+
+// FromCandles computes every indicator over the closes of candles, with
+// period for the SMA, EMA and Bollinger Bands and rsiPeriod for the RSI.
+// VWAP weights the typical price (high+low+close)/3 of each candle by its
+// volume.
+func FromCandles(candles []models.Candle, period, rsiPeriod int) Set {
+	set := Set{
+		Time:   make([]time.Time, len(candles)),
+		Close:  make(Series, len(candles)),
+		Volume: make([]int, len(candles)),
+	}
+	typical := make([]float64, len(candles))
+	volumes := make([]float64, len(candles))
+	for i, c := range candles {
+		set.Time[i] = c.Time
+		set.Close[i] = c.Close
+		set.Volume[i] = c.Volume
+		typical[i] = (c.High + c.Low + c.Close) / 3
+		volumes[i] = float64(c.Volume)
+	}
+
+	set.SMA = SMA(set.Close, period)
+	set.EMA = EMA(set.Close, period)
+	set.RSI = RSI(set.Close, rsiPeriod)
+	set.MACD.MACD, set.MACD.Signal, set.MACD.Histogram = MACD(set.Close, MACDFast, MACDSlow, MACDSignal)
+	set.Bollinger.Middle, set.Bollinger.Upper, set.Bollinger.Lower = Bollinger(set.Close, period, BollingerWidth)
+	set.VWAP = VWAP(typical, volumes)
+	return set
+}
+
+// Tail returns the last n entries of s. Indicators are computed before
+// cutting, so the entries keep their full warm-up.
+func (s Set) Tail(n int) Set {
+	if n >= len(s.Time) {
+		return s
+	}
+	from := len(s.Time) - n
+	return Set{
+		Time:   s.Time[from:],
+		Close:  s.Close[from:],
+		Volume: s.Volume[from:],
+		SMA:    s.SMA[from:],
+		EMA:    s.EMA[from:],
+		RSI:    s.RSI[from:],
+		MACD: MACDSet{
+			MACD:      s.MACD.MACD[from:],
+			Signal:    s.MACD.Signal[from:],
+			Histogram: s.MACD.Histogram[from:],
+		},
+		Bollinger: BandSet{
+			Middle: s.Bollinger.Middle[from:],
+			Upper:  s.Bollinger.Upper[from:],
+			Lower:  s.Bollinger.Lower[from:],
+		},
+		VWAP: s.VWAP[from:],
+	}
+}
+
+// Latest is the current value of every indicator, as pushed with price
+// updates. Values without enough history are omitted.
+type Latest struct {
+	SMA            *float64 `json:"sma,omitempty"`
+	EMA            *float64 `json:"ema,omitempty"`
+	RSI            *float64 `json:"rsi,omitempty"`
+	MACD           *float64 `json:"macd,omitempty"`
+	MACDSignal     *float64 `json:"macdSignal,omitempty"`
+	MACDHistogram  *float64 `json:"macdHistogram,omitempty"`
+	BollingerUpper *float64 `json:"bollingerUpper,omitempty"`
+	BollingerLower *float64 `json:"bollingerLower,omitempty"`
+	VWAP           *float64 `json:"vwap,omitempty"`
+}
+
+// Latest returns the last entry of every indicator in s.
+func (s Set) Latest() Latest {
+	return Latest{
+		SMA:            s.SMA.Last(),
+		EMA:            s.EMA.Last(),
+		RSI:            s.RSI.Last(),
+		MACD:           s.MACD.MACD.Last(),
+		MACDSignal:     s.MACD.Signal.Last(),
+		MACDHistogram:  s.MACD.Histogram.Last(),
+		BollingerUpper: s.Bollinger.Upper.Last(),
+		BollingerLower: s.Bollinger.Lower.Last(),
+		VWAP:           s.VWAP.Last(),
+	}
+}
@@ -0,0 +1,236 @@
+// Package jobs runs long tasks in the background, one at a time and in the
+// order they were submitted, and tracks their progress.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"midnight-trader/models"
+)
+
+var (
+	ErrNotFound  = errors.New("job not found")
+	ErrFinished  = errors.New("job already finished")
+	ErrQueueFull = errors.New("too many queued jobs")
+)
+
+const (
+	// queueSize is how many jobs may wait at once.
+	queueSize = 16
+	// keepFinished is how many finished jobs are remembered.
+	keepFinished = 50
+)
+
+// Progress reports how far a task has come, from 0 to 1, and what it is
+// doing.
+type Progress func(fraction float64, message string)
+
+// Task is the work of a job. It must return promptly once ctx is done.
+type Task func(ctx context.Context, progress Progress) (interface{}, error)
+
+type entry struct {
+	job       models.Job
+	task      Task
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// Manager queues jobs and runs them on a single worker.
+type Manager struct {
+	// Timeout bounds how long a job may run.
+	Timeout time.Duration
+	// OnUpdate is called with a copy of a job whenever it changes.
+	OnUpdate func(models.Job)
+
+	mu    sync.Mutex
+	jobs  map[string]*entry
+	order []string // job IDs in submission order
+	queue chan string
+}
+
+// NewManager returns a Manager and starts its worker.
+func NewManager(timeout time.Duration, onUpdate func(models.Job)) *Manager {
+	m := &Manager{
+		Timeout:  timeout,
+		OnUpdate: onUpdate,
+		jobs:     make(map[string]*entry),
+		queue:    make(chan string, queueSize),
+	}
+	go m.work()
+	return m
+}
+
+// Submit queues task as a new job of the given kind.
+func (m *Manager) Submit(kind, createdBy string, task Task) (models.Job, error) {
+	m.mu.Lock()
+	e := &entry{
+		job: models.Job{
+			ID:        models.NewID(),
+			Kind:      kind,
+			Status:    "queued",
+			CreatedBy: createdBy,
+			CreatedAt: time.Now(),
+		},
+		task: task,
+	}
+	select {
+	case m.queue <- e.job.ID:
+	default:
+		m.mu.Unlock()
+		return models.Job{}, ErrQueueFull
+	}
+	m.jobs[e.job.ID] = e
+	m.order = append(m.order, e.job.ID)
+	m.prune()
+	job := e.job
+	m.mu.Unlock()
+
+	m.notify(job)
+	return job, nil
+}
+
+// Get returns the job with the given ID.
+func (m *Manager) Get(id string) (models.Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.jobs[id]
+	if !ok {
+		return models.Job{}, false
+	}
+	return e.job, true
+}
+
+// List returns every remembered job, newest first.
+func (m *Manager) List() []models.Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]models.Job, 0, len(m.order))
+	for i := len(m.order) - 1; i >= 0; i-- {
+		out = append(out, m.jobs[m.order[i]].job)
+	}
+	return out
+}
+
+// Cancel stops a running job or drops a queued one. A running job is only
+// recorded as cancelled if its task gives up; one that finishes anyway keeps
+// its outcome.
+func (m *Manager) Cancel(id string) (models.Job, error) {
+	m.mu.Lock()
+	e, ok := m.jobs[id]
+	if !ok {
+		m.mu.Unlock()
+		return models.Job{}, ErrNotFound
+	}
+	if e.job.Done() {
+		job := e.job
+		m.mu.Unlock()
+		return job, ErrFinished
+	}
+
+	e.cancelled = true
+	if e.cancel != nil {
+		// The worker records the outcome once the task returns.
+		e.cancel()
+		job := e.job
+		m.mu.Unlock()
+		return job, nil
+	}
+	finish(&e.job, "cancelled")
+	job := e.job
+	m.mu.Unlock()
+
+	m.notify(job)
+	return job, nil
+}
+
+func (m *Manager) work() {
+	for id := range m.queue {
+		m.run(id)
+	}
+}
+
+func (m *Manager) run(id string) {
+	m.mu.Lock()
+	e, ok := m.jobs[id]
+	if !ok || e.job.Status != "queued" {
+		m.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeout)
+	defer cancel()
+	e.cancel = cancel
+	now := time.Now()
+	e.job.Status = "running"
+	e.job.StartedAt = &now
+	job := e.job
+	m.mu.Unlock()
+	m.notify(job)
+
+	result, err := e.task(ctx, func(fraction float64, message string) {
+		m.mu.Lock()
+		e.job.Progress = min(max(fraction, 0), 1)
+		e.job.Message = message
+		job := e.job
+		m.mu.Unlock()
+		m.notify(job)
+	})
+
+	// A cancel that comes in after the task has already succeeded is too
+	// late to stop it, so the result stands.
+	m.mu.Lock()
+	switch {
+	case e.cancelled && err != nil:
+		finish(&e.job, "cancelled")
+	case err != nil:
+		e.job.Error = err.Error()
+		if ctx.Err() == context.DeadlineExceeded {
+			e.job.Error = "timed out: " + e.job.Error
+		}
+		finish(&e.job, "failed")
+	default:
+		e.job.Result = result
+		e.job.Progress = 1
+		finish(&e.job, "succeeded")
+	}
+	job = e.job
+	m.mu.Unlock()
+	m.notify(job)
+}
+
+func finish(job *models.Job, status string) {
+	now := time.Now()
+	job.Status = status
+	job.FinishedAt = &now
+}
+
+func (m *Manager) notify(job models.Job) {
+	if m.OnUpdate != nil {
+		m.OnUpdate(job)
+	}
+}
+
+// prune forgets the oldest finished jobs beyond keepFinished. Callers must
+// hold mu.
+func (m *Manager) prune() {
+	finished := 0
+	for _, id := range m.order {
+		if m.jobs[id].job.Done() {
+			finished++
+		}
+	}
+	kept := m.order[:0]
+	for _, id := range m.order {
+		if finished > keepFinished && m.jobs[id].job.Done() {
+			delete(m.jobs, id)
+			finished--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	m.order = kept
+}
@@ -0,0 +1,184 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"midnight-trader/models"
+)
+
+// watcher records the status of every update of each job.
+type watcher struct {
+	mu       sync.Mutex
+	statuses map[string][]string
+	done     chan models.Job
+}
+
+func newTestManager(t *testing.T) (*Manager, *watcher) {
+	t.Helper()
+	w := &watcher{statuses: make(map[string][]string), done: make(chan models.Job, queueSize)}
+	m := NewManager(time.Second, func(job models.Job) {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		statuses := w.statuses[job.ID]
+		if len(statuses) == 0 || statuses[len(statuses)-1] != job.Status {
+			w.statuses[job.ID] = append(statuses, job.Status)
+		}
+		if job.Done() {
+			w.done <- job
+		}
+	})
+	return m, w
+}
+
+// wait returns the next job to finish.
+func (w *watcher) wait(t *testing.T) models.Job {
+	t.Helper()
+	select {
+	case job := <-w.done:
+		return job
+	case <-time.After(2 * time.Second):
+		t.Fatal("no job finished")
+		return models.Job{}
+	}
+}
+
+func (w *watcher) assertStatuses(t *testing.T, id string, want ...string) {
+	t.Helper()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	got := w.statuses[id]
+	if len(got) != len(want) {
+		t.Errorf("job went through %v, want %v", got, want)
+		return
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("job went through %v, want %v", got, want)
+			return
+		}
+	}
+}
+
+func TestJobSucceeds(t *testing.T) {
+	m, w := newTestManager(t)
+	job, err := m.Submit("generate", "alice", func(ctx context.Context, progress Progress) (interface{}, error) {
+		progress(0.5, "half way")
+		return "done", nil
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if job.Status != "queued" || job.ID == "" || job.CreatedBy != "alice" {
+		t.Errorf("submitted job = %+v, want queued with an ID", job)
+	}
+
+	done := w.wait(t)
+	if done.ID != job.ID || done.Status != "succeeded" || done.Result != "done" || done.Progress != 1 {
+		t.Errorf("job = %+v, want succeeded with its result", done)
+	}
+	if done.StartedAt == nil || done.FinishedAt == nil {
+		t.Errorf("job = %+v, want start and finish times", done)
+	}
+	w.assertStatuses(t, job.ID, "queued", "running", "succeeded")
+	if got, _ := m.Get(job.ID); got.Status != "succeeded" {
+		t.Errorf("Get = %+v, want the finished job", got)
+	}
+}
+
+func TestJobFails(t *testing.T) {
+	m, w := newTestManager(t)
+	job, _ := m.Submit("generate", "alice", func(ctx context.Context, progress Progress) (interface{}, error) {
+		return nil, errors.New("model unavailable")
+	})
+
+	done := w.wait(t)
+	if done.Status != "failed" || done.Error != "model unavailable" || done.Result != nil {
+		t.Errorf("job = %+v, want failed with the task's error", done)
+	}
+	w.assertStatuses(t, job.ID, "queued", "running", "failed")
+}
+
+func TestCancelRunningJob(t *testing.T) {
+	m, w := newTestManager(t)
+	started := make(chan struct{})
+	job, _ := m.Submit("generate", "alice", func(ctx context.Context, progress Progress) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	<-started
+
+	if _, err := m.Cancel(job.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if done := w.wait(t); done.Status != "cancelled" {
+		t.Errorf("job = %+v, want cancelled", done)
+	}
+	w.assertStatuses(t, job.ID, "queued", "running", "cancelled")
+
+	if _, err := m.Cancel(job.ID); err != ErrFinished {
+		t.Errorf("cancelling again: got %v, want ErrFinished", err)
+	}
+	if _, err := m.Cancel("missing"); err != ErrNotFound {
+		t.Errorf("cancelling a missing job: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestCancelQueuedJob(t *testing.T) {
+	m, w := newTestManager(t)
+	release := make(chan struct{})
+	first, _ := m.Submit("generate", "alice", func(ctx context.Context, progress Progress) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	ran := false
+	second, _ := m.Submit("append", "alice", func(ctx context.Context, progress Progress) (interface{}, error) {
+		ran = true
+		return nil, nil
+	})
+
+	cancelled, err := m.Cancel(second.ID)
+	if err != nil || cancelled.Status != "cancelled" {
+		t.Fatalf("Cancel = %+v, %v, want cancelled at once", cancelled, err)
+	}
+	if done := w.wait(t); done.ID != second.ID {
+		t.Fatalf("job %s finished first, want the cancelled one", done.Kind)
+	}
+	close(release)
+	if done := w.wait(t); done.ID != first.ID || done.Status != "succeeded" {
+		t.Errorf("job = %+v, want the first one succeeded", done)
+	}
+	if ran {
+		t.Error("the cancelled job ran")
+	}
+	w.assertStatuses(t, second.ID, "queued", "cancelled")
+
+	if jobs := m.List(); len(jobs) != 2 || jobs[0].ID != second.ID {
+		t.Errorf("List = %+v, want both jobs, newest first", jobs)
+	}
+}
+
+func TestCancelAfterTaskSucceeded(t *testing.T) {
+	m, w := newTestManager(t)
+	var job models.Job
+	submitted := make(chan struct{})
+	job, _ = m.Submit("generate", "alice", func(ctx context.Context, progress Progress) (interface{}, error) {
+		// The cancel comes in once the work is done but before the task
+		// has returned, as it would right after it returned.
+		<-submitted
+		if _, err := m.Cancel(job.ID); err != nil {
+			t.Errorf("Cancel: %v", err)
+		}
+		return "done", nil
+	})
+	close(submitted)
+
+	if done := w.wait(t); done.Status != "succeeded" || done.Result != "done" {
+		t.Errorf("job = %+v, want succeeded with its result", done)
+	}
+	w.assertStatuses(t, job.ID, "queued", "running", "succeeded")
+}
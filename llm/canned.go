@@ -0,0 +1,29 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// CannedResponse is the answer Canned gives to prompts containing Match.
+type CannedResponse struct {
+	Match string
+	Text  string
+}
+
+// Canned answers prompts from a fixed list without calling a model, so its
+// output is the same on every run. The first response whose Match occurs in
+// the prompt wins.
+type Canned struct {
+	Responses []CannedResponse
+}
+
+func (c *Canned) Generate(ctx context.Context, prompt string) (string, error) {
+	for _, r := range c.Responses {
+		if strings.Contains(prompt, r.Match) {
+			return r.Text, nil
+		}
+	}
+	return "", fmt.Errorf("no canned response for prompt")
+}
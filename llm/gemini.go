@@ -0,0 +1,69 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// DefaultGeminiModel is the model used when Gemini.Model is empty.
+const DefaultGeminiModel = "gemini-1.5-flash"
+
+// Gemini generates text with Google's Gemini API.
+type Gemini struct {
+	APIKey string
+	Model  string
+	// BaseURL defaults to the public API endpoint.
+	BaseURL string
+	Client  *http.Client
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"content"`
+	} `json:"candidates"`
+}
+
+func (g *Gemini) Generate(ctx context.Context, prompt string) (string, error) {
+	model := g.Model
+	if model == "" {
+		model = DefaultGeminiModel
+	}
+	base := g.BaseURL
+	if base == "" {
+		base = "https://generativelanguage.googleapis.com/v1beta"
+	}
+	endpoint := fmt.Sprintf("%s/models/%s:generateContent", base, url.PathEscape(model))
+	// The key goes in a header: request errors quote the URL, and they end
+	// up in job records.
+	header := http.Header{}
+	header.Set("x-goog-api-key", g.APIKey)
+
+	body := map[string]interface{}{
+		"contents": []map[string]interface{}{
+			{
+				"parts": []map[string]string{
+					{"text": prompt},
+				},
+			},
+		},
+	}
+	var result geminiResponse
+	if err := postJSON(ctx, g.Client, endpoint, header, body, &result); err != nil {
+		return "", err
+	}
+
+	if len(result.Candidates) == 0 {
+		return "", fmt.Errorf("no candidates found in AI response")
+	}
+	parts := result.Candidates[0].Content.Parts
+	if len(parts) == 0 {
+		return "", fmt.Errorf("no parts found in content")
+	}
+	return parts[0].Text, nil
+}
@@ -0,0 +1,78 @@
+// Package llm abstracts the language models that write companies, price
+// series and news. Gemini and any OpenAI-compatible server are supported,
+// and Canned answers without a model for tests and offline runs.
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// TextGenerator completes a prompt with text.
+type TextGenerator interface {
+	Generate(ctx context.Context, prompt string) (string, error)
+}
+
+// postJSON posts body as JSON to url and decodes the response into out.
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, body, out interface{}) error {
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(reqBody))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %v", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call model: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %v", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("model returned %s: %s", resp.Status, truncate(string(respBody), 200))
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse ai response: %v", err)
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// StripCodeFences removes the markdown code fences models like to wrap JSON
+// answers in.
+func StripCodeFences(text string) string {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```")
+		// Drop the language tag, e.g. "json".
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[i+1:]
+		}
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	}
+	return strings.TrimSpace(text)
+}
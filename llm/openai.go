@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OpenAI generates text with the chat completions endpoint of the OpenAI API
+// or any server that implements it, such as a local model server.
+type OpenAI struct {
+	// BaseURL is the API root, e.g. "http://localhost:11434/v1". It
+	// defaults to the OpenAI API.
+	BaseURL string
+	// APIKey is sent as a bearer token if set; local servers usually don't
+	// need one.
+	APIKey string
+	Model  string
+	Client *http.Client
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+}
+
+func (o *OpenAI) Generate(ctx context.Context, prompt string) (string, error) {
+	if o.Model == "" {
+		return "", fmt.Errorf("no model configured")
+	}
+	base := o.BaseURL
+	if base == "" {
+		base = "https://api.openai.com/v1"
+	}
+
+	header := http.Header{}
+	if o.APIKey != "" {
+		header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+	body := map[string]interface{}{
+		"model": o.Model,
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt},
+		},
+	}
+	var result openAIResponse
+	if err := postJSON(ctx, o.Client, strings.TrimSuffix(base, "/")+"/chat/completions", header, body, &result); err != nil {
+		return "", err
+	}
+
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("no choices found in AI response")
+	}
+	return result.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,89 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// DefaultAttempts is how many answers GenerateJSON asks for before giving up.
+const DefaultAttempts = 3
+
+// InvalidOutputError reports a model that kept answering with output that
+// failed to decode or validate.
+type InvalidOutputError struct {
+	Attempts int
+	// Problems holds what was wrong with each answer, in order.
+	Problems []string
+}
+
+func (e *InvalidOutputError) Error() string {
+	last := ""
+	if len(e.Problems) > 0 {
+		last = e.Problems[len(e.Problems)-1]
+	}
+	return fmt.Sprintf("model output still invalid after %d attempts: %s", e.Attempts, last)
+}
+
+// GenerateJSON asks gen to complete prompt with JSON, decodes the answer
+// into out and checks it with validate. An answer that fails either step is
+// sent back to the model together with the problem, up to attempts answers
+// in all; if none passes, the error is an *InvalidOutputError. Errors from
+// the model itself are returned as they are.
+func GenerateJSON(ctx context.Context, gen TextGenerator, prompt string, attempts int, out interface{}, validate func() error) error {
+	if attempts <= 0 {
+		attempts = DefaultAttempts
+	}
+
+	report := &InvalidOutputError{}
+	next := prompt
+	for report.Attempts < attempts {
+		text, err := gen.Generate(ctx, next)
+		if err != nil {
+			return err
+		}
+		report.Attempts++
+
+		problem := decode(text, out, validate)
+		if problem == nil {
+			return nil
+		}
+		report.Problems = append(report.Problems, problem.Error())
+		next = fmt.Sprintf(`%s
+
+your previous answer was:
+%s
+
+it was rejected: %v
+answer again with corrected json only.`, prompt, text, problem)
+	}
+	return report
+}
+
+// decode resets out and fills it from text, then validates it. A value of
+// the wrong type doesn't stop decoding, so it is reported together with
+// whatever validate finds.
+func decode(text string, out interface{}, validate func() error) error {
+	reflect.ValueOf(out).Elem().SetZero()
+	var problems []string
+	err := json.Unmarshal([]byte(StripCodeFences(text)), out)
+	var typeErr *json.UnmarshalTypeError
+	if err != nil && !errors.As(err, &typeErr) {
+		return fmt.Errorf("invalid json: %v", err)
+	}
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("%s has the wrong type (got %s)", typeErr.Field, typeErr.Value))
+	}
+	if validate != nil {
+		if err := validate(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
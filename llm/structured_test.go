@@ -0,0 +1,110 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type quote struct {
+	Ticker string  `json:"ticker"`
+	Price  float64 `json:"price"`
+}
+
+func (q *quote) validate() error {
+	if q.Price <= 0 {
+		return fmt.Errorf("price of %s must be positive", q.Ticker)
+	}
+	return nil
+}
+
+// recorder keeps every prompt it passes on to a generator.
+type recorder struct {
+	gen     TextGenerator
+	prompts []string
+}
+
+func (r *recorder) Generate(ctx context.Context, prompt string) (string, error) {
+	r.prompts = append(r.prompts, prompt)
+	return r.gen.Generate(ctx, prompt)
+}
+
+func TestGenerateJSONFirstTry(t *testing.T) {
+	gen := &recorder{gen: &Canned{Responses: []CannedResponse{
+		{Match: "quote", Text: "```json\n{\"ticker\": \"NMBS\", \"price\": 12.5}\n```"},
+	}}}
+
+	var q quote
+	if err := GenerateJSON(context.Background(), gen, "quote NMBS", 3, &q, q.validate); err != nil {
+		t.Fatalf("GenerateJSON: %v", err)
+	}
+	if q != (quote{Ticker: "NMBS", Price: 12.5}) {
+		t.Errorf("got %+v, want NMBS at 12.5", q)
+	}
+	if len(gen.prompts) != 1 {
+		t.Errorf("asked %d times, want once", len(gen.prompts))
+	}
+}
+
+func TestGenerateJSONRetriesInvalidJSON(t *testing.T) {
+	// The retry prompt repeats the original one, so its response must come
+	// first.
+	gen := &recorder{gen: &Canned{Responses: []CannedResponse{
+		{Match: "it was rejected", Text: `{"ticker": "NMBS", "price": 12.5}`},
+		{Match: "quote", Text: `{"ticker": "NMBS", "price": `},
+	}}}
+
+	var q quote
+	if err := GenerateJSON(context.Background(), gen, "quote NMBS", 3, &q, q.validate); err != nil {
+		t.Fatalf("GenerateJSON: %v", err)
+	}
+	if q.Price != 12.5 {
+		t.Errorf("got %+v, want the retried answer", q)
+	}
+	if len(gen.prompts) != 2 {
+		t.Fatalf("asked %d times, want twice", len(gen.prompts))
+	}
+	retry := gen.prompts[1]
+	if !strings.HasPrefix(retry, "quote NMBS") || !strings.Contains(retry, `"price": `) || !strings.Contains(retry, "invalid json") {
+		t.Errorf("retry prompt %q doesn't repeat the prompt, the answer and the problem", retry)
+	}
+}
+
+func TestGenerateJSONGivesUp(t *testing.T) {
+	gen := &recorder{gen: &Canned{Responses: []CannedResponse{
+		{Match: "it was rejected", Text: `{"ticker": "NMBS", "price": -1}`},
+		{Match: "quote", Text: `{"ticker": "NMBS", "price": "cheap"}`},
+	}}}
+
+	var q quote
+	err := GenerateJSON(context.Background(), gen, "quote NMBS", 3, &q, q.validate)
+	var invalid *InvalidOutputError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("got %v, want an InvalidOutputError", err)
+	}
+	if invalid.Attempts != 3 || len(gen.prompts) != 3 {
+		t.Errorf("gave up after %d attempts and %d prompts, want 3", invalid.Attempts, len(gen.prompts))
+	}
+	want := []string{
+		"price has the wrong type (got string); price of NMBS must be positive",
+		"price of NMBS must be positive",
+		"price of NMBS must be positive",
+	}
+	if strings.Join(invalid.Problems, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems = %q, want %q", invalid.Problems, want)
+	}
+	if !strings.HasSuffix(err.Error(), "after 3 attempts: price of NMBS must be positive") {
+		t.Errorf("error %q doesn't end with the last problem", err)
+	}
+}
+
+func TestGenerateJSONModelError(t *testing.T) {
+	var q quote
+	err := GenerateJSON(context.Background(), &Canned{}, "quote NMBS", 3, &q, q.validate)
+	var invalid *InvalidOutputError
+	if err == nil || errors.As(err, &invalid) {
+		t.Errorf("got %v, want the model's own error", err)
+	}
+}
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"log"
+	"midnight-trader/auth"
 	"midnight-trader/controllers"
 	"midnight-trader/db"
-	"midnight-trader/models"
 	"midnight-trader/routes"
+	"midnight-trader/store"
+	"midnight-trader/trading"
 	"midnight-trader/websocket"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -16,30 +21,205 @@ import (
 	"github.com/joho/godotenv"
 )
 
-func main() {
-	godotenv.Load()
+// roomStoreFactory selects the persistence backend from STORE_BACKEND.
+// "memory" runs without a database; anything else connects to MongoDB, with
+// the default room in the main database and every other room in its own.
+// Prices stored together are recorded tickInterval apart.
+func roomStoreFactory(tickInterval time.Duration) func(ctx context.Context, room string) (store.Store, error) {
+	if os.Getenv("STORE_BACKEND") == "memory" {
+		log.Println("Using in-memory store")
+		return func(ctx context.Context, room string) (store.Store, error) {
+			s := store.NewMemoryStore()
+			s.TickInterval = tickInterval
+			return s, nil
+		}
+	}
 
 	// Connect to the database
 	db.ConnectDB()
-	database := db.GetDB()
 
-	// Initialize the WebSocketBroadcaster
-	// Initialize the WebSocket hub
-	hub := models.NewHub()
-	go hub.Run()
+	return func(ctx context.Context, room string) (store.Store, error) {
+		database := db.GetDB()
+		if room != controllers.DefaultRoom {
+			database = db.GetRoomDB(room)
+		}
+		s, err := store.NewMongoStore(ctx, database)
+		if err != nil {
+			return nil, err
+		}
+		s.TickInterval = tickInterval
+		return s, nil
+	}
+}
+
+// marketSeed returns MARKET_SEED if set, otherwise a time-based seed. The seed
+// is logged so any game can be replayed.
+func marketSeed() int64 {
+	seed := time.Now().UnixNano()
+	if v := os.Getenv("MARKET_SEED"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid MARKET_SEED %q: %v", v, err)
+		}
+		seed = parsed
+	}
+	log.Println("Market seed:", seed)
+	return seed
+}
+
+// envDuration parses the duration in the environment variable name, or
+// returns def if it is unset.
+func envDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", name, v, err)
+	}
+	return d
+}
+
+// authSecret returns the key bearer tokens are signed with. Without
+// AUTH_SECRET a random key is used, so tokens don't survive a restart.
+func authSecret() []byte {
+	if v := os.Getenv("AUTH_SECRET"); v != "" {
+		return []byte(v)
+	}
+	log.Println("AUTH_SECRET not set; using a random secret, tokens will not survive a restart")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("Failed to generate auth secret: %v", err)
+	}
+	return secret
+}
+
+// envFloat parses the number in the environment variable name, or returns
+// def if it is unset.
+func envFloat(name string, def float64) float64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		log.Fatalf("Invalid %s %q", name, v)
+	}
+	return f
+}
+
+// envInt parses the whole number in the environment variable name, or
+// returns def if it is unset.
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Fatalf("Invalid %s %q", name, v)
+	}
+	return n
+}
+
+func main() {
+	godotenv.Load()
 
 	// now we can safely initialize collections
 
 	controllers.InitAI()
 
-	// Initialize all collections
-	controllers.SetCompanyCollection(database)
-	controllers.SetTradeCollection(database)
-	controllers.SetPortfolioCollection(database)
-	controllers.SetTransactionsCollection(database)
+	// Initialize the persistence backend
+	tickInterval := envDuration("PRICE_TICK_INTERVAL", controllers.DefaultTickInterval)
+	controllers.SetRoomStoreFactory(roomStoreFactory(tickInterval))
+	controllers.SetRoomLimits(
+		envInt("MAX_ROOMS", controllers.DefaultMaxRooms),
+		envInt("MAX_ROOMS_PER_PLAYER", controllers.DefaultMaxRoomsPerOwner),
+	)
+
+	// Settings for every room; new rooms may override them.
+	roomDefaults := controllers.RoomConfig{
+		RoundDuration:     30 * time.Second, // Example: 30-second rounds, total 5 rounds
+		TotalRounds:       5,
+		TickInterval:      tickInterval,
+		LobbyDuration:     envDuration("LOBBY_DURATION", controllers.DefaultLobbyDuration),
+		CountdownDuration: envDuration("COUNTDOWN_DURATION", controllers.DefaultCountdownDuration),
+		MinPlayers:        controllers.DefaultMinPlayers,
+		NewsSource:        os.Getenv("NEWS_SOURCE"),
+		NewsChance:        envFloat("NEWS_CHANCE", controllers.DefaultNewsChance),
+		Indicators:        os.Getenv("PUSH_INDICATORS") == "true",
+		Margin: trading.MarginConfig{
+			InitialMargin: envFloat("MARGIN_INITIAL", trading.DefaultMargin.InitialMargin),
+			MarginCall:    envFloat("MARGIN_CALL", trading.DefaultMargin.MarginCall),
+			Maintenance:   envFloat("MARGIN_MAINTENANCE", trading.DefaultMargin.Maintenance),
+			BorrowRate:    envFloat("SHORT_BORROW_RATE", trading.DefaultMargin.BorrowRate),
+			Leverage:      os.Getenv("MARGIN_LEVERAGE") != "false",
+			LoanRate:      envFloat("MARGIN_LOAN_RATE", trading.DefaultMargin.LoanRate),
+		},
+		Fees: trading.FeeConfig{
+			Flat:    envFloat("FEE_FLAT", trading.DefaultFees.Flat),
+			Percent: envFloat("FEE_PERCENT", trading.DefaultFees.Percent),
+			Minimum: envFloat("FEE_MINIMUM", trading.DefaultFees.Minimum),
+		},
+		Impact: trading.ImpactConfig{
+			Coefficient: envFloat("IMPACT_COEFFICIENT", trading.DefaultImpact.Coefficient),
+			Liquidity:   envFloat("IMPACT_LIQUIDITY", trading.DefaultImpact.Liquidity),
+		},
+	}
+	if v := os.Getenv("MIN_PLAYERS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatalf("Invalid MIN_PLAYERS %q", v)
+		}
+		roomDefaults.MinPlayers = n
+	}
+
+	// Create the default room, which serves requests that don't name one.
+	mainConfig := roomDefaults
+	mainConfig.Seed = marketSeed()
+	roomCtx, roomCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	mainRoom, err := controllers.CreateRoom(roomCtx, controllers.DefaultRoom, "", mainConfig)
+	if err != nil {
+		log.Fatalf("Failed to create default room: %v", err)
+	}
+	roomCancel()
+
+	// Accounts and the admin audit log are shared by every room and kept with
+	// the default room's data.
+	accounts, ok := mainRoom.Store.(store.AccountStore)
+	if !ok {
+		log.Fatal("Store backend does not support accounts")
+	}
+	audit, ok := mainRoom.Store.(store.AuditStore)
+	if !ok {
+		log.Fatal("Store backend does not support the audit log")
+	}
+	controllers.SetAuth(accounts, audit, auth.NewSigner(authSecret(), 24*time.Hour))
+
+	// The admin account comes from ADMIN_USERNAME and ADMIN_PASSWORD. Without
+	// a password no one can use the admin endpoints.
+	if username := os.Getenv("ADMIN_USERNAME"); username != "" {
+		controllers.AdminUsername = username
+	}
+	if password := os.Getenv("ADMIN_PASSWORD"); password != "" {
+		adminCtx, adminCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := controllers.EnsureAdmin(adminCtx, controllers.AdminUsername, password)
+		adminCancel()
+		if err == controllers.ErrAdminTaken {
+			log.Printf("Player account %s already exists; admin endpoints are disabled", controllers.AdminUsername)
+		} else if err != nil {
+			log.Fatalf("Failed to set up admin account: %v", err)
+		}
+	} else {
+		log.Println("ADMIN_PASSWORD not set; admin endpoints are disabled")
+	}
 
 	// Initialize routes
-	r := gin.Default()
+	r := gin.New()
+	// The WebSocket token is taken out of the query before the logger
+	// writes it to the access log.
+	r.Use(controllers.StripQueryToken(), gin.Logger(), gin.Recovery())
 	// Update CORS configuration
 	r.Use(cors.New(cors.Config{
 		AllowAllOrigins: true,
@@ -50,58 +230,103 @@ func main() {
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
-	r.GET("/ws", func(c *gin.Context) {
-		websocket.ServeWs(hub, c.Writer, c.Request)
+	r.GET("/ws", controllers.WebSocketAuthMiddleware(), controllers.RoomMiddleware(), func(c *gin.Context) {
+		websocket.ServeWs(controllers.RoomFrom(c), controllers.CurrentPlayer(c), c.Writer, c.Request)
 	})
-	// Initialize RoundManager and assign to global for access in controllers.
-	roundManager := controllers.NewRoundManager(hub, 30*time.Second, 5) // Example: 30-second rounds, total 5 rounds
-	controllers.CurrentRoundManager = roundManager
-	// Initialize the RoundController
-	roundController := controllers.NewRoundController(roundManager, hub)
+
+	// Price series come from the local simulator unless PRICE_SOURCE=gemini.
+	generateData := controllers.SimulateHistoricalDataHandler()
+	appendData := controllers.SimulateAppendHistoricalDataHandler()
+	if os.Getenv("PRICE_SOURCE") == "gemini" {
+		generateData = controllers.GenerateHistoricalData()
+		appendData = controllers.AppendGeneratedHistoricalData()
+	}
 
 	routes.WebSocketRoutes(r)
 	routes.CompanyRoutes(r)
-	api := r.Group("/api")
+	authRoutes := r.Group("/api/auth")
+	{
+		authRoutes.POST("/register", controllers.RegisterHandler())
+		authRoutes.POST("/login", controllers.LoginHandler())
+		authRoutes.GET("/me", controllers.AuthMiddleware(), controllers.MeHandler())
+	}
+
+	r.GET("/api/admin/audit", controllers.AuthMiddleware(), controllers.AdminMiddleware("view_audit"), controllers.GetAuditLogHandler())
+
+	rooms := r.Group("/api/rooms")
+	{
+		rooms.GET("", controllers.ListRoomsHandler())
+		rooms.POST("", controllers.AuthMiddleware(), controllers.CreateRoomHandler(roomDefaults))
+		rooms.GET("/:name", controllers.GetRoomHandler())
+	}
+
+	// Every other endpoint acts on the room named by the "room" query
+	// parameter, or the default room.
+	api := r.Group("/api", controllers.RoomMiddleware())
 	{
 		api.GET("/companies", controllers.GetCompaniesHandler)
-		api.DELETE("/companies", controllers.ClearData) // <- add this
-		api.POST("/generate", controllers.GenerateCompanies)
-		api.POST("/generate/data", controllers.GenerateHistoricalData(hub))
-		api.POST("/generate/append", controllers.AppendGeneratedHistoricalData(hub))
-
-		api.POST("/portfolio", controllers.CreatePortfolioHandler(hub))
-		api.GET("/portfolio", controllers.GetPortfolioHandler(hub))
-		api.DELETE("/portfolio", controllers.DeletePortfolioHandler(hub))
+		api.GET("/companies/:ticker/candles", controllers.GetCandlesHandler())
+		api.GET("/companies/:ticker/indicators", controllers.GetIndicatorsHandler())
 		api.GET("/portfolios", controllers.GetPortfoliosHandler())
+		api.GET("/portfolio/history", controllers.GetPortfolioHistoryHandler())
+		api.GET("/orderbook/:ticker", controllers.GetOrderBookHandler())
+		api.GET("/round/status", controllers.RoundHandler((*controllers.RoundController).GetRoundStatus))
+		api.GET("/rounds", controllers.GetRoundsHandler())
+		api.GET("/rounds/:id", controllers.GetRoundHandler())
+		api.GET("/news", controllers.GetNewsHandler())
+		api.GET("/analytics", controllers.GetAnalyticsHandler())
+	}
 
-		api.GET("/trades", controllers.GetTradesHandler())
-		api.POST("/trades", controllers.ExecuteTradeHandler(hub, db.Client))
+	// Endpoints that act for a player take the player from the bearer token.
+	player := api.Group("", controllers.AuthMiddleware())
+	{
+		// Admin only: these wipe or regenerate the room's data.
+		player.DELETE("/companies", controllers.AdminMiddleware("clear_data"), controllers.ClearData)
+		player.POST("/generate", controllers.AdminMiddleware("generate_companies"), controllers.GenerateCompanies)
+		player.POST("/generate/data", controllers.AdminMiddleware("generate_data"), generateData)
+		player.POST("/generate/append", controllers.AdminMiddleware("append_data"), appendData)
+		player.DELETE("/jobs/:id", controllers.AdminMiddleware("cancel_job"), controllers.CancelJobHandler())
+		player.GET("/jobs", controllers.GetJobsHandler())
+		player.GET("/jobs/:id", controllers.GetJobHandler())
 
-		api.GET("/round/status", roundController.GetRoundStatus)
-		api.POST("/round/start", roundController.StartRound)
-		api.POST("/round/end", roundController.EndRound)
-		api.POST("/round/join", roundController.JoinRound)
-		api.POST("/round/update", roundController.UpdatePortfolio)
+		player.POST("/portfolio", controllers.CreatePortfolioHandler())
+		player.GET("/portfolio", controllers.GetPortfolioHandler())
+		player.GET("/portfolio/performance", controllers.GetPerformanceHandler())
+		player.DELETE("/portfolio", controllers.DeletePortfolioHandler())
+
+		player.GET("/trades", controllers.GetTradesHandler())
+		player.POST("/trades", controllers.ExecuteTradeHandler())
+
+		player.GET("/orders", controllers.GetOrdersHandler())
+		player.POST("/orders", controllers.PlaceOrderHandler())
+		player.DELETE("/orders/:id", controllers.CancelOrderHandler())
+
+		player.GET("/conditional-orders", controllers.GetConditionalOrdersHandler())
+		player.POST("/conditional-orders", controllers.PlaceConditionalOrderHandler())
+		player.DELETE("/conditional-orders/:id", controllers.CancelConditionalOrderHandler())
+
+		player.POST("/round/start", controllers.AdminMiddleware("start_round"), controllers.RoundHandler((*controllers.RoundController).StartRound))
+		player.POST("/round/end", controllers.AdminMiddleware("end_round"), controllers.RoundHandler((*controllers.RoundController).EndRound))
+		player.POST("/round/join", controllers.RoundHandler((*controllers.RoundController).JoinRound))
+		player.POST("/round/ready", controllers.RoundHandler((*controllers.RoundController).SetReady))
+		player.POST("/round/update", controllers.RoundHandler((*controllers.RoundController).UpdatePortfolio))
 
 		// Note: StartRound and EndRound are now managed by RoundManager
 		// You can still provide endpoints to manually control rounds if desired
 		// For example:
-		api.POST("/round/start_manual", func(c *gin.Context) {
-			roundManager.StartNextRound()
+		player.POST("/round/start_manual", controllers.AdminMiddleware("start_manual"), func(c *gin.Context) {
+			controllers.RoomFrom(c).Rounds.StartNow()
 			c.JSON(http.StatusOK, gin.H{"message": "manual round start triggered"})
 		})
-		api.POST("/round/end_manual", func(c *gin.Context) {
-			roundManager.EndRound()
+		player.POST("/round/end_manual", controllers.AdminMiddleware("end_manual"), func(c *gin.Context) {
+			controllers.RoomFrom(c).Rounds.EndRound()
 			c.JSON(http.StatusOK, gin.H{"message": "manual round end triggered"})
 		})
-
 	}
 	routes.TradeRoutes(r)
 	routes.PortfolioRoutes(r)
 	routes.RoundRoutes(r)
 
-	roundManager.Start()
-
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -0,0 +1,82 @@
+package market
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"midnight-trader/models"
+)
+
+// point is a price observed at a time, with the shares traded at it.
+type point struct {
+	time   time.Time
+	price  float64
+	volume int
+}
+
+// Candles aggregates the price ticks and trades of one company into candles
+// of length interval, oldest first. Trades contribute their execution price
+// as well as their volume. A fill between two players appears in the trade
+// log once for each side, so only its buy side is counted. Intervals without
+// prices or trades get no candle.
+func Candles(ticks []models.PriceTick, trades []models.Trade, interval time.Duration) []models.Candle {
+	points := make([]point, 0, len(ticks)+len(trades))
+	for _, t := range ticks {
+		points = append(points, point{time: t.Time, price: t.Price})
+	}
+	for _, t := range trades {
+		if t.Counterparty != "" && t.Type != "buy" {
+			continue
+		}
+		points = append(points, point{time: t.Timestamp, price: t.Price, volume: t.Amount})
+	}
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].time.Before(points[j].time)
+	})
+
+	candles := make([]models.Candle, 0)
+	for _, p := range points {
+		start := p.time.Truncate(interval)
+		n := len(candles)
+		if n == 0 || !candles[n-1].Time.Equal(start) {
+			candles = append(candles, models.Candle{
+				Time: start,
+				Open: p.price,
+				High: p.price,
+				Low:  p.price,
+			})
+			n++
+		}
+		c := &candles[n-1]
+		c.High = math.Max(c.High, p.price)
+		c.Low = math.Min(c.Low, p.price)
+		c.Close = p.price
+		c.Volume += p.volume
+	}
+	return candles
+}
+
+// TickCandles turns every price tick of one company into a candle of its
+// own, carrying the volume traded since the previous tick, so that
+// indicators can run over the full tick history.
+func TickCandles(ticks []models.PriceTick, trades []models.Trade) []models.Candle {
+	trades = slices.Clone(trades)
+	sort.SliceStable(trades, func(i, j int) bool {
+		return trades[i].Timestamp.Before(trades[j].Timestamp)
+	})
+
+	candles := make([]models.Candle, 0, len(ticks))
+	next := 0
+	for _, t := range ticks {
+		c := models.Candle{Time: t.Time, Open: t.Price, High: t.Price, Low: t.Price, Close: t.Price}
+		for ; next < len(trades) && !trades[next].Timestamp.After(t.Time); next++ {
+			if trade := trades[next]; trade.Counterparty == "" || trade.Type == "buy" {
+				c.Volume += trade.Amount
+			}
+		}
+		candles = append(candles, c)
+	}
+	return candles
+}
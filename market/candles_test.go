@@ -0,0 +1,79 @@
+package market
+
+import (
+	"testing"
+	"time"
+
+	"midnight-trader/models"
+)
+
+var candleStart = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func at(seconds int) time.Time {
+	return candleStart.Add(time.Duration(seconds) * time.Second)
+}
+
+func candleTicks(prices ...float64) []models.PriceTick {
+	ticks := make([]models.PriceTick, len(prices))
+	for i, price := range prices {
+		ticks[i] = models.PriceTick{Ticker: "NMBS", Price: price, Time: at(i * 20)}
+	}
+	return ticks
+}
+
+// candleTrades has a fill between two players, logged once per side, and a
+// trade at market.
+func candleTrades() []models.Trade {
+	return []models.Trade{
+		{Type: "sell", Amount: 4, Price: 13, Timestamp: at(30), Counterparty: "alice"},
+		{Type: "buy", Amount: 4, Price: 13, Timestamp: at(30), Counterparty: "bob"},
+		{Type: "sell", Amount: 2, Price: 8, Timestamp: at(70)},
+	}
+}
+
+func TestCandles(t *testing.T) {
+	// Ticks at 0s, 20s, ..., 100s.
+	candles := Candles(candleTicks(10, 12, 11, 9, 10, 12), candleTrades(), time.Minute)
+
+	want := []models.Candle{
+		{Time: at(0), Open: 10, High: 13, Low: 10, Close: 11, Volume: 4},
+		{Time: at(60), Open: 9, High: 12, Low: 8, Close: 12, Volume: 2},
+	}
+	if len(candles) != len(want) {
+		t.Fatalf("got %d candles, want %d: %+v", len(candles), len(want), candles)
+	}
+	for i := range want {
+		if candles[i] != want[i] {
+			t.Errorf("candle %d = %+v, want %+v", i, candles[i], want[i])
+		}
+	}
+}
+
+func TestCandlesSkipEmptyIntervals(t *testing.T) {
+	ticks := []models.PriceTick{
+		{Price: 10, Time: at(0)},
+		{Price: 11, Time: at(300)},
+	}
+	candles := Candles(ticks, nil, time.Minute)
+	if len(candles) != 2 || !candles[1].Time.Equal(at(300)) {
+		t.Errorf("got %+v, want two candles five minutes apart", candles)
+	}
+}
+
+func TestTickCandles(t *testing.T) {
+	candles := TickCandles(candleTicks(10, 12, 11, 9), candleTrades())
+
+	want := []struct {
+		price  float64
+		volume int
+	}{{10, 0}, {12, 0}, {11, 4}, {9, 0}}
+	if len(candles) != len(want) {
+		t.Fatalf("got %d candles, want %d", len(candles), len(want))
+	}
+	for i, w := range want {
+		c := candles[i]
+		if c.Open != w.price || c.Close != w.price || c.Volume != w.volume {
+			t.Errorf("candle %d = %+v, want price %v and volume %d", i, c, w.price, w.volume)
+		}
+	}
+}
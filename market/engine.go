@@ -0,0 +1,233 @@
+// Package market implements the local price engine that drives company stock
+// prices without relying on an external model.
+package market
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"sync"
+
+	"midnight-trader/models"
+)
+
+// minPrice keeps simulated prices strictly positive.
+const minPrice = 0.01
+
+// security is the simulation state of a single company.
+type security struct {
+	profile    Profile
+	price      float64
+	trend      float64 // log of the price the company is reverting towards
+	crashTicks int     // remaining ticks of an active crash regime
+	rng        *rand.Rand
+}
+
+// Engine simulates prices for a set of companies. Every company has its own
+// random stream derived from the engine seed and its ticker, so a given seed
+// always produces the same series for the same sequence of calls.
+type Engine struct {
+	mu         sync.Mutex
+	seed       int64
+	securities map[string]*security
+}
+
+// NewEngine returns an Engine seeded with seed.
+func NewEngine(seed int64) *Engine {
+	return &Engine{
+		seed:       seed,
+		securities: make(map[string]*security),
+	}
+}
+
+// Seed returns the seed the engine was created with.
+func (e *Engine) Seed() int64 {
+	return e.seed
+}
+
+func (e *Engine) newRand(ticker string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(ticker))
+	return rand.New(rand.NewPCG(uint64(e.seed), h.Sum64()))
+}
+
+func (e *Engine) newSecurity(ticker string, price float64, profile Profile) *security {
+	price = math.Max(price, minPrice)
+	return &security{
+		profile: profile,
+		price:   price,
+		trend:   math.Log(price),
+		rng:     e.newRand(ticker),
+	}
+}
+
+// Sync aligns the engine with the given companies. Unknown companies are
+// registered at their current stock price, companies that no longer exist are
+// dropped, and known companies adopt their stored price so that changes made
+// outside the engine are not lost. Profiles are reassigned whenever the set
+// of tickers changes.
+func (e *Engine) Sync(companies []models.Company) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	seen := make(map[string]bool, len(companies))
+	tickers := make([]string, 0, len(companies))
+	changed := false
+	for _, c := range companies {
+		seen[c.Ticker] = true
+		tickers = append(tickers, c.Ticker)
+		if _, ok := e.securities[c.Ticker]; !ok {
+			changed = true
+		}
+	}
+	for ticker := range e.securities {
+		if !seen[ticker] {
+			delete(e.securities, ticker)
+			changed = true
+		}
+	}
+
+	var profiles map[string]Profile
+	if changed {
+		profiles = AssignProfiles(e.seed, tickers)
+	}
+	for _, c := range companies {
+		sec, ok := e.securities[c.Ticker]
+		if !ok {
+			e.securities[c.Ticker] = e.newSecurity(c.Ticker, c.StockPrice, profiles[c.Ticker])
+			continue
+		}
+		if changed {
+			sec.profile = profiles[c.Ticker]
+		}
+		if c.StockPrice > 0 {
+			sec.price = c.StockPrice
+		}
+	}
+}
+
+// Reset restarts a company's simulation from price with a fresh random
+// stream, so that repeated calls produce identical series.
+func (e *Engine) Reset(ticker string, price float64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sec, ok := e.securities[ticker]
+	if !ok {
+		return fmt.Errorf("unknown ticker %s", ticker)
+	}
+	e.securities[ticker] = e.newSecurity(ticker, price, sec.profile)
+	return nil
+}
+
+// Profile returns the profile assigned to ticker.
+func (e *Engine) Profile(ticker string) (Profile, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sec, ok := e.securities[ticker]
+	if !ok {
+		return Profile{}, false
+	}
+	return sec.profile, true
+}
+
+// Price returns the engine's current price for ticker.
+func (e *Engine) Price(ticker string) (float64, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sec, ok := e.securities[ticker]
+	if !ok {
+		return 0, false
+	}
+	return sec.price, true
+}
+
+// Shock moves ticker's price by the relative amount move, e.g. -0.1 for a 10%
+// drop, and returns the new price. Like a jump, a shock is news rather than
+// noise, so the trend moves with it and the price doesn't revert.
+func (e *Engine) Shock(ticker string, move float64) (float64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sec, ok := e.securities[ticker]
+	if !ok {
+		return 0, fmt.Errorf("unknown ticker %s", ticker)
+	}
+	if move <= -1 {
+		return 0, fmt.Errorf("shock must be above -100%%")
+	}
+	jump := math.Log1p(move)
+	sec.trend += jump
+	sec.price = math.Max(roundCents(sec.price*math.Exp(jump)), minPrice)
+	return sec.price, nil
+}
+
+// Series advances ticker by n ticks and returns the resulting prices.
+func (e *Engine) Series(ticker string, n int) ([]float64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sec, ok := e.securities[ticker]
+	if !ok {
+		return nil, fmt.Errorf("unknown ticker %s", ticker)
+	}
+	prices := make([]float64, n)
+	for i := range prices {
+		prices[i] = sec.step()
+	}
+	return prices, nil
+}
+
+// Step advances every company by one tick and returns the new prices.
+func (e *Engine) Step() map[string]float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	tickers := make([]string, 0, len(e.securities))
+	for ticker := range e.securities {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+
+	prices := make(map[string]float64, len(tickers))
+	for _, ticker := range tickers {
+		prices[ticker] = e.securities[ticker].step()
+	}
+	return prices
+}
+
+// step advances the security by one tick and returns its new price.
+func (s *security) step() float64 {
+	p := s.profile
+
+	drift := p.Drift
+	if s.crashTicks > 0 {
+		drift = p.CrashDrift
+		s.crashTicks--
+	} else if p.CrashProbability > 0 && s.rng.Float64() < p.CrashProbability {
+		s.crashTicks = p.CrashLength
+	}
+	s.trend += drift
+
+	x := math.Log(s.price)
+	x += p.MeanReversion * (s.trend - x)
+	// GBM increment with the Itô correction so Drift is the median log return.
+	x += -0.5*p.Volatility*p.Volatility + p.Volatility*s.rng.NormFloat64()
+	if p.JumpProbability > 0 && s.rng.Float64() < p.JumpProbability {
+		jump := p.JumpMean + p.JumpStdDev*s.rng.NormFloat64()
+		x += jump
+		// Jumps are news, not noise: move the trend with them.
+		s.trend += jump
+	}
+
+	s.price = math.Max(roundCents(math.Exp(x)), minPrice)
+	return s.price
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
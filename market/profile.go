@@ -0,0 +1,115 @@
+package market
+
+import (
+	"math/rand/v2"
+	"slices"
+)
+
+// Profile describes how a single company's price evolves from tick to tick.
+//
+// Prices follow a geometric Brownian motion around a trend line: the trend
+// grows by Drift each tick, the log price is pulled back towards it by
+// MeanReversion, and Volatility adds Gaussian noise. On top of that, jumps
+// occur with JumpProbability and a crash regime can be entered with
+// CrashProbability, during which the trend itself falls by CrashDrift per
+// tick for CrashLength ticks.
+type Profile struct {
+	Archetype        string  `json:"archetype"`
+	Drift            float64 `json:"drift"`
+	Volatility       float64 `json:"volatility"`
+	MeanReversion    float64 `json:"meanReversion"`
+	JumpProbability  float64 `json:"jumpProbability"`
+	JumpMean         float64 `json:"jumpMean"`
+	JumpStdDev       float64 `json:"jumpStdDev"`
+	CrashProbability float64 `json:"crashProbability"`
+	CrashDrift       float64 `json:"crashDrift"`
+	CrashLength      int     `json:"crashLength"`
+}
+
+// Archetypes are the built-in profiles. They are handed out in this order,
+// so any market of two or more companies contains at least one strong
+// winner and one company that fails badly.
+var Archetypes = []Profile{
+	{
+		Archetype:     "rocket",
+		Drift:         0.045,
+		Volatility:    0.04,
+		MeanReversion: 0.25,
+		// Occasional good news on top of the strong trend.
+		JumpProbability: 0.08,
+		JumpMean:        0.10,
+		JumpStdDev:      0.05,
+	},
+	{
+		Archetype:        "crasher",
+		Drift:            -0.01,
+		Volatility:       0.05,
+		MeanReversion:    0.3,
+		JumpProbability:  0.05,
+		JumpMean:         -0.15,
+		JumpStdDev:       0.05,
+		CrashProbability: 0.15,
+		CrashDrift:       -0.12,
+		CrashLength:      5,
+	},
+	{
+		Archetype:       "grower",
+		Drift:           0.02,
+		Volatility:      0.025,
+		MeanReversion:   0.2,
+		JumpProbability: 0.03,
+		JumpMean:        0.04,
+		JumpStdDev:      0.03,
+	},
+	{
+		Archetype:       "decliner",
+		Drift:           -0.025,
+		Volatility:      0.03,
+		MeanReversion:   0.2,
+		JumpProbability: 0.04,
+		JumpMean:        -0.06,
+		JumpStdDev:      0.03,
+	},
+	{
+		Archetype:       "volatile",
+		Drift:           0.005,
+		Volatility:      0.09,
+		MeanReversion:   0.1,
+		JumpProbability: 0.1,
+		JumpMean:        0,
+		JumpStdDev:      0.15,
+	},
+	{
+		Archetype:     "steady",
+		Drift:         0.004,
+		Volatility:    0.01,
+		MeanReversion: 0.4,
+	},
+	{
+		Archetype:        "boom-bust",
+		Drift:            0.03,
+		Volatility:       0.05,
+		MeanReversion:    0.15,
+		CrashProbability: 0.06,
+		CrashDrift:       -0.15,
+		CrashLength:      4,
+	},
+}
+
+// AssignProfiles deterministically maps each ticker to a profile. Tickers are
+// sorted and then shuffled with seed, so the same seed and ticker set always
+// produces the same assignment regardless of input order.
+func AssignProfiles(seed int64, tickers []string) map[string]Profile {
+	sorted := slices.Clone(tickers)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+
+	rng := rand.New(rand.NewPCG(uint64(seed), 0))
+	rng.Shuffle(len(sorted), func(i, j int) { sorted[i], sorted[j] = sorted[j], sorted[i] })
+
+	profiles := make(map[string]Profile, len(sorted))
+	for i, ticker := range sorted {
+		profiles[ticker] = Archetypes[i%len(Archetypes)]
+	}
+	return profiles
+}
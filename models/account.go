@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// RoleAdmin is the role of accounts allowed to run admin actions.
+const RoleAdmin = "admin"
+
+// Account is a registered player. Username is the player name used
+// everywhere else in the game.
+type Account struct {
+	Username     string    `json:"username" bson:"username"`
+	PasswordHash string    `json:"-" bson:"passwordHash"`
+	Role         string    `json:"role,omitempty" bson:"role,omitempty"`
+	CreatedAt    time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// AuditEntry records one invocation of an admin action.
+type AuditEntry struct {
+	Admin  string    `json:"admin" bson:"admin"`
+	Action string    `json:"action" bson:"action"`
+	Room   string    `json:"room" bson:"room"`
+	Method string    `json:"method" bson:"method"`
+	Path   string    `json:"path" bson:"path"`
+	Status int       `json:"status" bson:"status"`
+	Time   time.Time `json:"time" bson:"time"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// PriceTick is a company's stock price at the time it was recorded.
+type PriceTick struct {
+	Ticker string    `json:"ticker" bson:"ticker"`
+	Price  float64   `json:"price" bson:"price"`
+	Time   time.Time `json:"time" bson:"time"`
+}
+
+// Candle summarizes the prices and trades of one company over an interval
+// starting at Time.
+type Candle struct {
+	Time   time.Time `json:"time"`
+	Open   float64   `json:"open"`
+	High   float64   `json:"high"`
+	Low    float64   `json:"low"`
+	Close  float64   `json:"close"`
+	Volume int       `json:"volume"` // shares traded
+}
@@ -5,5 +5,9 @@ type Company struct {
 	Ticker                string    `json:"ticker" bson:"ticker"`
 	Description           string    `json:"description" bson:"description"`
 	StockPrice            float64   `json:"stockPrice" bson:"stockPrice"`
+	Sector                string    `json:"sector,omitempty" bson:"sector,omitempty"`
 	HistoricalStockPrices []float64 `json:"historicalStockPrices" bson:"historicalStockPrices"`
+	// Liquidity is the traded value that moves the price by the room's
+	// impact coefficient. Zero uses the room's default.
+	Liquidity float64 `json:"liquidity,omitempty" bson:"liquidity,omitempty"`
 }
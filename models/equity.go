@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// EquitySnapshot is a player's net equity at one point in time. Snapshots
+// are taken on every price tick of a round and make up the equity curve.
+type EquitySnapshot struct {
+	Player  string    `json:"player" bson:"player"`
+	RoundID int       `json:"roundId,omitempty" bson:"roundId,omitempty"`
+	Equity  float64   `json:"equity" bson:"equity"`
+	Time    time.Time `json:"time" bson:"time"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// NewID returns a random identifier for an order, job, news item or any
+// other record that needs one.
+func NewID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Job is a long-running task, such as generating companies with the
+// language model, that runs in the background while clients poll it or
+// follow its "job_updated" events.
+type Job struct {
+	ID     string `json:"id"`
+	Kind   string `json:"kind"`
+	Status string `json:"status"` // "queued", "running", "succeeded", "failed" or "cancelled"
+	// Progress runs from 0 to 1; Message describes the current step.
+	Progress   float64     `json:"progress"`
+	Message    string      `json:"message,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	Result     interface{} `json:"result,omitempty"`
+	CreatedBy  string      `json:"createdBy,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	StartedAt  *time.Time  `json:"startedAt,omitempty"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+}
+
+// Done reports whether the job has finished, one way or another.
+func (j *Job) Done() bool {
+	return j.Status == "succeeded" || j.Status == "failed" || j.Status == "cancelled"
+}
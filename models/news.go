@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// News is a market headline. It names either a single company by Ticker or a
+// whole Sector, and moves the price of every company it affects by Shock.
+type News struct {
+	ID       string `json:"id" bson:"id"`
+	RoundID  int    `json:"roundId,omitempty" bson:"roundId,omitempty"`
+	Headline string `json:"headline" bson:"headline"`
+	Body     string `json:"body,omitempty" bson:"body,omitempty"`
+	Ticker   string `json:"ticker,omitempty" bson:"ticker,omitempty"`
+	Sector   string `json:"sector,omitempty" bson:"sector,omitempty"`
+	// Shock is the relative price move, e.g. -0.12 for a 12% drop.
+	Shock  float64 `json:"shock" bson:"shock"`
+	Source string  `json:"source" bson:"source"` // "llm" or "template"
+	// Prices holds the price of every affected company after the shock.
+	Prices map[string]float64 `json:"prices,omitempty" bson:"prices,omitempty"`
+	Time   time.Time          `json:"time" bson:"time"`
+}
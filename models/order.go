@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+)
+
+// Order is a standing or immediate request to trade shares with other players.
+type Order struct {
+	ID        string    `json:"id" bson:"id"`
+	Player    string    `json:"player" bson:"player"`
+	Ticker    string    `json:"ticker" bson:"ticker"`
+	Side      string    `json:"side" bson:"side"`   // "buy" or "sell"
+	Type      string    `json:"type" bson:"type"`   // "limit" or "market"
+	Price     float64   `json:"price" bson:"price"` // limit price; unused for market orders
+	Quantity  int       `json:"quantity" bson:"quantity"`
+	Filled    int       `json:"filled" bson:"filled"`
+	Reserved  float64   `json:"reserved" bson:"reserved"` // funds held back for an unfilled buy
+	Status    string    `json:"status" bson:"status"`     // "open", "partial", "filled", "cancelled"
+	Sequence  uint64    `json:"-" bson:"sequence"`        // time priority within a price level
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+// Remaining returns the number of shares still to be filled.
+func (o *Order) Remaining() int {
+	return o.Quantity - o.Filled
+}
+
+// IsOpen reports whether the order can still be filled.
+func (o *Order) IsOpen() bool {
+	return o.Status == "open" || o.Status == "partial"
+}
+
+// ConditionalOrder is a standing instruction to trade once a company's price
+// crosses a trigger. When it triggers, stop-loss, take-profit and trailing
+// stop orders trade at market; a stop-limit order places a limit order on
+// the book.
+type ConditionalOrder struct {
+	ID       string `json:"id" bson:"id"`
+	Player   string `json:"player" bson:"player"`
+	Ticker   string `json:"ticker" bson:"ticker"`
+	Side     string `json:"side" bson:"side"` // "buy" or "sell"
+	Type     string `json:"type" bson:"type"` // "stop_loss", "take_profit", "trailing_stop" or "stop_limit"
+	Quantity int    `json:"quantity" bson:"quantity"`
+	// TriggerPrice is the price that triggers the order. Trailing stops
+	// move it as the price moves in the player's favour.
+	TriggerPrice float64 `json:"triggerPrice" bson:"triggerPrice"`
+	LimitPrice   float64 `json:"limitPrice,omitempty" bson:"limitPrice,omitempty"` // stop_limit only
+	// A trailing stop trails the best price seen since it was placed by
+	// either a percentage or a fixed amount.
+	TrailPercent float64   `json:"trailPercent,omitempty" bson:"trailPercent,omitempty"`
+	TrailAmount  float64   `json:"trailAmount,omitempty" bson:"trailAmount,omitempty"`
+	BestPrice    float64   `json:"bestPrice,omitempty" bson:"bestPrice,omitempty"`
+	Status       string    `json:"status" bson:"status"`                       // "pending", "triggered", "failed" or "cancelled"
+	Error        string    `json:"error,omitempty" bson:"error,omitempty"`     // why a triggered order failed
+	OrderID      string    `json:"orderId,omitempty" bson:"orderId,omitempty"` // book order placed by a stop_limit
+	CreatedAt    time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt" bson:"updatedAt"`
+}
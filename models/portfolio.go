@@ -1,7 +1,20 @@
 package models
 
+import "time"
+
 type Portfolio struct {
 	Player    string         `json:"player" bson:"player"`
 	Companies map[string]int `json:"companies" bson:"companies"`
 	Funds     float64        `json:"funds" bson:"funds"`
+	// Funds and shares held back by open orders on the order book.
+	ReservedFunds  float64        `json:"reservedFunds,omitempty" bson:"reservedFunds,omitempty"`
+	ReservedShares map[string]int `json:"reservedShares,omitempty" bson:"reservedShares,omitempty"`
+	// Loan is the cash borrowed to buy on margin, including accrued interest.
+	Loan float64 `json:"loan,omitempty" bson:"loan,omitempty"`
+	// FeesPaid is the total trading commission the player has paid.
+	FeesPaid float64 `json:"feesPaid,omitempty" bson:"feesPaid,omitempty"`
+	// Since is when the portfolio was created or last reset. Transactions
+	// before it belong to an earlier portfolio and don't count towards its
+	// cost basis.
+	Since time.Time `json:"since" bson:"since"`
 }
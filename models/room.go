@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// RoomInfo summarizes a game room for listings.
+type RoomInfo struct {
+	Name            string    `json:"name"`
+	Unlisted        bool      `json:"unlisted,omitempty"`
+	CreatedAt       time.Time `json:"createdAt"`
+	Status          string    `json:"status,omitempty"` // status of the current round, if any
+	RoundID         int       `json:"roundId,omitempty"`
+	Players         int       `json:"players"`
+	CompletedRounds int       `json:"completedRounds"`
+	TotalRounds     int       `json:"totalRounds"`
+}
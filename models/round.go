@@ -12,6 +12,28 @@ type RoundState struct {
 	EndTime      time.Time   `json:"endTime,omitempty"`
 	Participants []Portfolio `json:"players,omitempty"`
 	Winner       *Portfolio  `json:"winner,omitempty"`
+	Leaderboard  []Standing  `json:"leaderboard,omitempty" bson:"leaderboard,omitempty"`
+	// Company prices when the round started and ended, keyed by ticker.
+	StartPrices map[string]float64 `json:"startPrices,omitempty" bson:"startPrices,omitempty"`
+	EndPrices   map[string]float64 `json:"endPrices,omitempty" bson:"endPrices,omitempty"`
+
+	// Lobby state; only meaningful while Status is "lobby".
+	Ready       map[string]bool `json:"ready,omitempty" bson:"-"`
+	LobbyEndsAt time.Time       `json:"lobbyEndsAt,omitempty" bson:"-"`
+	StartsAt    time.Time       `json:"startsAt,omitempty" bson:"-"` // set once the countdown begins
+}
+
+// Standing is one entry of a round leaderboard.
+type Standing struct {
+	Rank      int            `json:"rank" bson:"rank"`
+	Player    string         `json:"player" bson:"player"`
+	Value     float64        `json:"value" bson:"value"`
+	Funds     float64        `json:"funds" bson:"funds"`
+	Loan      float64        `json:"loan,omitempty" bson:"loan,omitempty"`
+	Companies map[string]int `json:"companies" bson:"companies"`
+	// What open orders still held back when the round ended.
+	ReservedFunds  float64        `json:"reservedFunds,omitempty" bson:"reservedFunds,omitempty"`
+	ReservedShares map[string]int `json:"reservedShares,omitempty" bson:"reservedShares,omitempty"`
 }
 
 // Global variables (ensure proper initialization and synchronization)
@@ -34,5 +56,10 @@ type RoundManager struct {
 	Timer           *time.Timer
 	TimerTicker     *time.Ticker
 	TimerStopChan   chan struct{}
-}
+	TickInterval    time.Duration // How often prices move during a round; 0 disables ticking
+	PriceTicker     *time.Ticker
 
+	LobbyDuration     time.Duration // How long the lobby stays open before checking MinPlayers
+	CountdownDuration time.Duration // Countdown between a full lobby and the round start
+	MinPlayers        int           // Players needed before a round may start
+}
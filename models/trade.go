@@ -5,11 +5,19 @@ import (
 )
 
 type Trade struct {
-	Player    string    `json:"player" bson:"player"`
-	Company   string    `json:"company" bson:"company"`
-	Ticker    string    `json:"ticker" bson:"ticker"`
-	Type      string    `json:"type" bson:"type"` // "buy" or "sell"
-	Amount    int       `json:"amount" bson:"amount"`
-	Price     float64   `json:"price" bson:"price"`
-	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
+	Player  string  `json:"player" bson:"player"`
+	Company string  `json:"company" bson:"company"`
+	Ticker  string  `json:"ticker" bson:"ticker"`
+	Type    string  `json:"type" bson:"type"` // "buy" or "sell"
+	Amount  int     `json:"amount" bson:"amount"`
+	Price   float64 `json:"price" bson:"price"` // average execution price
+	// MarketPrice is the quoted price before the trade moved it.
+	MarketPrice float64   `json:"marketPrice,omitempty" bson:"marketPrice,omitempty"`
+	Fee         float64   `json:"fee,omitempty" bson:"fee,omitempty"` // commission charged on top of the trade value
+	Timestamp   time.Time `json:"timestamp" bson:"timestamp"`
+	// Set for trades matched on the order book between two players.
+	OrderID      string `json:"orderId,omitempty" bson:"orderId,omitempty"`
+	Counterparty string `json:"counterparty,omitempty" bson:"counterparty,omitempty"`
+	// Set for trades forced by the margin system, such as short buy-ins.
+	Liquidation bool `json:"liquidation,omitempty" bson:"liquidation,omitempty"`
 }
@@ -12,8 +12,9 @@ type WSMessage struct {
 }
 
 type Client struct {
-	Conn *websocket.Conn
-	Send chan WSMessage
+	Conn   *websocket.Conn
+	Send   chan WSMessage
+	Player string // authenticated player behind the connection
 }
 
 type Hub struct {
@@ -67,6 +68,24 @@ func (h *Hub) Run() {
 	}
 }
 
+// SendTo delivers message only to the connections of player, such as
+// warnings that concern nobody else.
+func (h *Hub) SendTo(player string, message WSMessage) {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+	for client := range h.Clients {
+		if client.Player != player {
+			continue
+		}
+		select {
+		case client.Send <- message:
+		default:
+			close(client.Send)
+			delete(h.Clients, client)
+		}
+	}
+}
+
 // ReadPump handles incoming messages from a client (optional, as we only send from server)
 func (c *Client) ReadPump(h *Hub) {
 	defer func() {
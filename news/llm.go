@@ -0,0 +1,63 @@
+package news
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"midnight-trader/llm"
+	"midnight-trader/models"
+)
+
+// LLMGenerator asks a language model for a headline. If the model fails or
+// its answer is unusable, the headline comes from Fallback instead, if set.
+type LLMGenerator struct {
+	Model llm.TextGenerator
+	// Attempts is how many answers to ask for before giving up on invalid
+	// ones; zero means llm.DefaultAttempts.
+	Attempts int
+	Fallback Generator
+}
+
+const llmPrompt = `you write breaking news for a stock trading game.
+the input is a json array of companies with keys "name", "ticker", "description", "sector", "stockPrice".
+write one short, dramatic headline about a single company or a whole sector, such as an earnings beat, a regulator rejecting a product, a CEO scandal or a takeover rumor.
+format the response as a json object with the keys "ticker" (the company's ticker, or "" for sector news), "sector" (the sector, or "" for company news), "headline", "body" (one sentence) and "shock" (the relative price move the news causes, between -%[1]g and %[1]g, e.g. -0.12 for a 12%% drop).
+here's the companies data: %[2]s`
+
+func (g *LLMGenerator) Generate(ctx context.Context, companies []models.Company) (models.News, error) {
+	n, err := g.generate(ctx, companies)
+	if err != nil && g.Fallback != nil {
+		log.Printf("LLM news failed, using fallback: %v", err)
+		return g.Fallback.Generate(ctx, companies)
+	}
+	return n, err
+}
+
+func (g *LLMGenerator) generate(ctx context.Context, companies []models.Company) (models.News, error) {
+	if len(companies) == 0 {
+		return models.News{}, fmt.Errorf("no companies to write news about")
+	}
+
+	// Price histories would only bloat the prompt.
+	brief := make([]models.Company, len(companies))
+	for i, c := range companies {
+		c.HistoricalStockPrices = nil
+		brief[i] = c
+	}
+	companiesData, err := json.Marshal(brief)
+	if err != nil {
+		return models.News{}, fmt.Errorf("failed to marshal companies: %v", err)
+	}
+
+	var n models.News
+	prompt := fmt.Sprintf(llmPrompt, MaxShock, companiesData)
+	err = llm.GenerateJSON(ctx, g.Model, prompt, g.Attempts, &n, func() error {
+		return validate(&n, companies)
+	})
+	if err != nil {
+		return models.News{}, err
+	}
+	n.Source = "llm"
+	return n, nil
+}
@@ -0,0 +1,55 @@
+// Package news writes the market headlines published during a round. Every
+// headline carries a price shock for the companies it names; applying the
+// shock is up to the caller.
+package news
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+
+	"midnight-trader/models"
+)
+
+// MaxShock bounds the price move a single headline may cause.
+const MaxShock = 0.3
+
+// Generator writes a headline about one of the given companies or their
+// sectors.
+type Generator interface {
+	Generate(ctx context.Context, companies []models.Company) (models.News, error)
+}
+
+// Affected returns the tickers of the companies n applies to.
+func Affected(n models.News, companies []models.Company) []string {
+	var tickers []string
+	for _, c := range companies {
+		if n.Ticker != "" && c.Ticker == n.Ticker || n.Sector != "" && c.Sector == n.Sector {
+			tickers = append(tickers, c.Ticker)
+		}
+	}
+	return tickers
+}
+
+// validate checks that n names exactly one known ticker or sector and has a
+// headline, and clamps its shock to MaxShock.
+func validate(n *models.News, companies []models.Company) error {
+	if n.Headline == "" {
+		return fmt.Errorf("news has no headline")
+	}
+	if (n.Ticker == "") == (n.Sector == "") {
+		return fmt.Errorf("news must name either a ticker or a sector")
+	}
+	if n.Ticker != "" && !slices.ContainsFunc(companies, func(c models.Company) bool { return c.Ticker == n.Ticker }) {
+		return fmt.Errorf("unknown ticker %s", n.Ticker)
+	}
+	if n.Sector != "" && !slices.ContainsFunc(companies, func(c models.Company) bool { return c.Sector == n.Sector }) {
+		return fmt.Errorf("unknown sector %s", n.Sector)
+	}
+	if math.IsNaN(n.Shock) {
+		return fmt.Errorf("shock is not a number")
+	}
+	n.Shock = math.Max(-MaxShock, math.Min(MaxShock, n.Shock))
+	return nil
+}
@@ -0,0 +1,88 @@
+package news
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+
+	"midnight-trader/models"
+)
+
+// template is a canned headline. Company templates are formatted with the
+// company name and ticker, sector templates with the sector name. The shock
+// is drawn uniformly from [Min, Max].
+type template struct {
+	Headline string
+	Body     string
+	Min, Max float64
+	Sector   bool
+}
+
+var templates = []template{
+	{Headline: "%[1]s (%[2]s) beats earnings expectations", Body: "Quarterly revenue came in well ahead of analyst estimates.", Min: 0.04, Max: 0.12},
+	{Headline: "%[1]s (%[2]s) misses earnings as costs balloon", Body: "Margins shrank for the third quarter in a row.", Min: -0.12, Max: -0.04},
+	{Headline: "Regulators reject %[1]s's flagship product", Body: "The company says it will appeal, but analysts expect a delay of at least a year.", Min: -0.25, Max: -0.1},
+	{Headline: "%[1]s wins approval for its lead product", Body: "Approval came months ahead of schedule.", Min: 0.08, Max: 0.2},
+	{Headline: "%[1]s CEO under investigation", Body: "The board has placed the chief executive on leave pending an inquiry.", Min: -0.2, Max: -0.08},
+	{Headline: "%[1]s announces record share buyback", Body: "The program is the largest in the company's history.", Min: 0.03, Max: 0.08},
+	{Headline: "Rumors swirl of a takeover bid for %[1]s (%[2]s)", Body: "Neither company would comment.", Min: 0.06, Max: 0.18},
+	{Headline: "%[1]s recalls products after safety complaints", Body: "The recall covers every unit sold this year.", Min: -0.15, Max: -0.05},
+	{Headline: "%[1]s signs major partnership deal", Body: "The multi-year agreement is expected to double the company's reach.", Min: 0.04, Max: 0.12},
+	{Headline: "Analysts downgrade %[2]s to sell", Body: "Slowing growth and rising competition were cited.", Min: -0.08, Max: -0.02},
+	{Headline: "New regulation threatens the %[1]s sector", Body: "Lawmakers proposed sweeping rules that would raise compliance costs.", Min: -0.1, Max: -0.03, Sector: true},
+	{Headline: "Investors pile into %[1]s stocks", Body: "Fund flows into the sector hit a yearly high.", Min: 0.03, Max: 0.09, Sector: true},
+	{Headline: "Supply shortage hits the %[1]s sector", Body: "Companies warn that delays could last several quarters.", Min: -0.12, Max: -0.04, Sector: true},
+	{Headline: "Government announces subsidies for %[1]s", Body: "The package is larger than the industry had hoped for.", Min: 0.04, Max: 0.1, Sector: true},
+}
+
+// TemplateGenerator writes headlines from a fixed set of templates without
+// calling out to a model. A given seed always produces the same headlines
+// for the same companies.
+type TemplateGenerator struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewTemplateGenerator returns a TemplateGenerator seeded with seed.
+func NewTemplateGenerator(seed int64) *TemplateGenerator {
+	return &TemplateGenerator{rng: rand.New(rand.NewPCG(uint64(seed), 1))}
+}
+
+func (g *TemplateGenerator) Generate(ctx context.Context, companies []models.Company) (models.News, error) {
+	if len(companies) == 0 {
+		return models.News{}, fmt.Errorf("no companies to write news about")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var sectors []string
+	seen := make(map[string]bool)
+	for _, c := range companies {
+		if c.Sector != "" && !seen[c.Sector] {
+			seen[c.Sector] = true
+			sectors = append(sectors, c.Sector)
+		}
+	}
+
+	t := templates[g.rng.IntN(len(templates))]
+	for t.Sector && len(sectors) == 0 {
+		t = templates[g.rng.IntN(len(templates))]
+	}
+
+	n := models.News{
+		Body:   t.Body,
+		Shock:  t.Min + g.rng.Float64()*(t.Max-t.Min),
+		Source: "template",
+	}
+	if t.Sector {
+		n.Sector = sectors[g.rng.IntN(len(sectors))]
+		n.Headline = fmt.Sprintf(t.Headline, n.Sector)
+	} else {
+		c := companies[g.rng.IntN(len(companies))]
+		n.Ticker = c.Ticker
+		n.Headline = fmt.Sprintf(t.Headline, c.Name, c.Ticker)
+	}
+	return n, nil
+}
@@ -0,0 +1,200 @@
+// Package orderbook implements per-ticker limit order books with price-time
+// priority matching between players.
+package orderbook
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"midnight-trader/models"
+)
+
+// Fill is a single match between a buy order and a sell order. Buy and Sell
+// are snapshots of both orders immediately after the fill. Fee is the
+// commission on the fill, which the buyer pays out of its Reserved funds.
+type Fill struct {
+	Ticker    string       `json:"ticker"`
+	Price     float64      `json:"price"`
+	Quantity  int          `json:"quantity"`
+	Fee       float64      `json:"fee"`
+	Buy       models.Order `json:"buy"`
+	Sell      models.Order `json:"sell"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+// Level is the aggregated quantity resting at one price.
+type Level struct {
+	Price    float64 `json:"price"`
+	Quantity int     `json:"quantity"`
+	Orders   int     `json:"orders"`
+}
+
+// Book holds the resting orders for a single ticker. Bids are kept best
+// (highest) price first and asks best (lowest) price first; orders at the
+// same price are kept in arrival order.
+type Book struct {
+	Ticker string
+	bids   []*models.Order
+	asks   []*models.Order
+}
+
+// NewBook returns an empty book for ticker.
+func NewBook(ticker string) *Book {
+	return &Book{Ticker: ticker}
+}
+
+// crosses reports whether taker is willing to trade at price.
+func crosses(taker *models.Order, price float64) bool {
+	if taker.Type == "market" {
+		return true
+	}
+	if taker.Side == "buy" {
+		return taker.Price >= price
+	}
+	return taker.Price <= price
+}
+
+// updateStatus derives an order's status from its fill progress.
+func updateStatus(o *models.Order) {
+	switch {
+	case o.Remaining() == 0:
+		o.Status = "filled"
+	case o.Filled > 0:
+		o.Status = "partial"
+	default:
+		o.Status = "open"
+	}
+}
+
+// affordable returns how many of up to max shares at price a buyer with
+// reserved funds can pay for, fee included.
+func affordable(reserved, price float64, max int, fee func(float64) float64) int {
+	// Small epsilon so float drift never costs a buyer its last share.
+	n := sort.Search(max+1, func(qty int) bool {
+		cost := price * float64(qty)
+		return cost+fee(cost) > reserved+1e-9
+	})
+	return n - 1
+}
+
+// match fills taker against the opposite side of the book and returns the
+// fills along with the resting orders that are done. A buyer never pays more
+// than its Reserved funds for the shares and their fee; a resting buyer that
+// can no longer pay for any share leaves the book cancelled. A player's own
+// resting orders are skipped rather than matched.
+func (b *Book) match(taker *models.Order, now time.Time, fee func(float64) float64) (fills []Fill, done []*models.Order) {
+	opposite := &b.asks
+	if taker.Side == "sell" {
+		opposite = &b.bids
+	}
+
+	for i := 0; i < len(*opposite) && taker.Remaining() > 0; {
+		maker := (*opposite)[i]
+		if !crosses(taker, maker.Price) {
+			break
+		}
+		if maker.Player == taker.Player {
+			i++
+			continue
+		}
+
+		qty := min(taker.Remaining(), maker.Remaining())
+		buy, sell := taker, maker
+		if taker.Side == "sell" {
+			buy, sell = maker, taker
+		}
+		qty = affordable(buy.Reserved, maker.Price, qty, fee)
+		if qty <= 0 && buy == maker {
+			maker.Status = "cancelled"
+			maker.UpdatedAt = now
+			*opposite = append((*opposite)[:i], (*opposite)[i+1:]...)
+			done = append(done, maker)
+			continue
+		}
+		if qty <= 0 {
+			break
+		}
+
+		cost := maker.Price * float64(qty)
+		buy.Reserved = math.Max(0, buy.Reserved-cost-fee(cost))
+		taker.Filled += qty
+		maker.Filled += qty
+		taker.UpdatedAt, maker.UpdatedAt = now, now
+		updateStatus(taker)
+		updateStatus(maker)
+
+		fills = append(fills, Fill{
+			Ticker:    b.Ticker,
+			Price:     maker.Price,
+			Quantity:  qty,
+			Fee:       fee(cost),
+			Buy:       *buy,
+			Sell:      *sell,
+			Timestamp: now,
+		})
+
+		if maker.Remaining() == 0 {
+			*opposite = append((*opposite)[:i], (*opposite)[i+1:]...)
+			done = append(done, maker)
+			continue
+		}
+		// The maker is only partially filled, so the taker is exhausted.
+		break
+	}
+	return fills, done
+}
+
+// rest adds an order to its side of the book, behind any orders at the same price.
+func (b *Book) rest(o *models.Order) {
+	side := &b.bids
+	better := func(a, c *models.Order) bool { return a.Price > c.Price }
+	if o.Side == "sell" {
+		side = &b.asks
+		better = func(a, c *models.Order) bool { return a.Price < c.Price }
+	}
+
+	i := sort.Search(len(*side), func(i int) bool {
+		other := (*side)[i]
+		if better(o, other) {
+			return true
+		}
+		return other.Price == o.Price && other.Sequence > o.Sequence
+	})
+	*side = append(*side, nil)
+	copy((*side)[i+1:], (*side)[i:])
+	(*side)[i] = o
+}
+
+// remove takes an order out of the book, reporting whether it was found.
+func (b *Book) remove(o *models.Order) bool {
+	side := &b.bids
+	if o.Side == "sell" {
+		side = &b.asks
+	}
+	for i, resting := range *side {
+		if resting.ID == o.ID {
+			*side = append((*side)[:i], (*side)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Depth aggregates both sides of the book by price.
+func (b *Book) Depth() (bids, asks []Level) {
+	return aggregate(b.bids), aggregate(b.asks)
+}
+
+func aggregate(orders []*models.Order) []Level {
+	levels := []Level{}
+	for _, o := range orders {
+		if n := len(levels); n > 0 && levels[n-1].Price == o.Price {
+			levels[n-1].Quantity += o.Remaining()
+			levels[n-1].Orders++
+			continue
+		}
+		levels = append(levels, Level{Price: o.Price, Quantity: o.Remaining(), Orders: 1})
+	}
+	return levels
+}
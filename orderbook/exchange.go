@@ -0,0 +1,218 @@
+package orderbook
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"midnight-trader/models"
+)
+
+var (
+	// ErrOrderNotFound is returned when an order is not resting on any book.
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrNotOwner is returned when a player tries to cancel someone else's order.
+	ErrNotOwner = errors.New("order belongs to another player")
+)
+
+// Exchange owns the order books for every ticker.
+type Exchange struct {
+	// Fee returns the commission on a fill worth value, which buyers must
+	// have reserved along with the price. Nil means no commission.
+	Fee func(value float64) float64
+
+	mu     sync.Mutex
+	books  map[string]*Book
+	orders map[string]*models.Order // resting orders by ID
+	seq    uint64
+}
+
+// NewExchange returns an Exchange with no orders.
+func NewExchange() *Exchange {
+	return &Exchange{
+		books:  make(map[string]*Book),
+		orders: make(map[string]*models.Order),
+	}
+}
+
+func (e *Exchange) book(ticker string) *Book {
+	b, ok := e.books[ticker]
+	if !ok {
+		b = NewBook(ticker)
+		e.books[ticker] = b
+	}
+	return b
+}
+
+// Validate checks the fields a caller must supply on a new order.
+func Validate(o models.Order) error {
+	if o.Player == "" || o.Ticker == "" {
+		return fmt.Errorf("player and ticker must not be empty")
+	}
+	if o.Side != "buy" && o.Side != "sell" {
+		return fmt.Errorf("side must be 'buy' or 'sell'")
+	}
+	if o.Type != "limit" && o.Type != "market" {
+		return fmt.Errorf("type must be 'limit' or 'market'")
+	}
+	if o.Quantity <= 0 {
+		return fmt.Errorf("quantity must be positive")
+	}
+	if o.Type == "limit" && o.Price <= 0 {
+		return fmt.Errorf("limit price must be positive")
+	}
+	return nil
+}
+
+// Submit matches a new order against its ticker's book. Any limit order
+// remainder rests on the book; a market order remainder is cancelled. Buy
+// orders must carry the funds they may spend, fees included, in Reserved. It returns the
+// final state of the order, the fills it produced, and the resting orders
+// that those fills completed.
+func (e *Exchange) Submit(order models.Order) (models.Order, []Fill, []models.Order, error) {
+	if err := Validate(order); err != nil {
+		return order, nil, nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	e.seq++
+	if order.ID == "" {
+		order.ID = models.NewID()
+	}
+	if order.Type == "market" {
+		order.Price = 0
+	}
+	order.Filled = 0
+	order.Sequence = e.seq
+	order.CreatedAt = now
+	order.UpdatedAt = now
+	order.Status = "open"
+
+	o := &order
+	b := e.book(order.Ticker)
+	fee := e.Fee
+	if fee == nil {
+		fee = func(float64) float64 { return 0 }
+	}
+	fills, done := b.match(o, now, fee)
+
+	var completed []models.Order
+	for _, maker := range done {
+		delete(e.orders, maker.ID)
+		completed = append(completed, *maker)
+	}
+
+	if o.Remaining() > 0 {
+		if o.Type == "limit" {
+			b.rest(o)
+			e.orders[o.ID] = o
+		} else {
+			o.Status = "cancelled"
+		}
+	}
+	return *o, fills, completed, nil
+}
+
+// Restore places a previously persisted open order back on its book without
+// matching it. It is used to rebuild the books at startup.
+func (e *Exchange) Restore(order models.Order) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if order.Sequence > e.seq {
+		e.seq = order.Sequence
+	}
+	o := &order
+	e.book(order.Ticker).rest(o)
+	e.orders[o.ID] = o
+}
+
+// Revert undoes the resting side of fills that could not be settled. Each
+// maker gets the filled quantity and the funds it spent, fees included, back, and a maker
+// that a fill completed returns to its book in its old place. The taker is
+// left to the caller. It returns the reverted makers.
+func (e *Exchange) Revert(fills []Fill) []models.Order {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var reverted []models.Order
+	for _, fill := range fills {
+		snapshot := fill.Sell
+		if fill.Sell.Sequence > fill.Buy.Sequence {
+			snapshot = fill.Buy
+		}
+		o, ok := e.orders[snapshot.ID]
+		if !ok {
+			o = &snapshot
+			e.book(o.Ticker).rest(o)
+			e.orders[o.ID] = o
+		}
+		o.Filled -= fill.Quantity
+		if o.Side == "buy" {
+			o.Reserved += fill.Price*float64(fill.Quantity) + fill.Fee
+		}
+		updateStatus(o)
+		reverted = append(reverted, *o)
+	}
+	return reverted
+}
+
+// Cancel removes a resting order owned by player from its book.
+func (e *Exchange) Cancel(id, player string) (models.Order, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, ok := e.orders[id]
+	if !ok {
+		return models.Order{}, ErrOrderNotFound
+	}
+	if o.Player != player {
+		return models.Order{}, ErrNotOwner
+	}
+	e.book(o.Ticker).remove(o)
+	delete(e.orders, id)
+
+	o.Status = "cancelled"
+	o.UpdatedAt = time.Now()
+	return *o, nil
+}
+
+// Order returns a resting order by ID.
+func (e *Exchange) Order(id string) (models.Order, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, ok := e.orders[id]
+	if !ok {
+		return models.Order{}, false
+	}
+	return *o, true
+}
+
+// Depth returns the aggregated bids and asks for ticker.
+func (e *Exchange) Depth(ticker string) (bids, asks []Level) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.book(ticker).Depth()
+}
+
+// OpenOrders returns the resting orders owned by player in time priority.
+func (e *Exchange) OpenOrders(player string) []models.Order {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var out []models.Order
+	for _, o := range e.orders {
+		if o.Player == player {
+			out = append(out, *o)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Sequence < out[j].Sequence })
+	return out
+}
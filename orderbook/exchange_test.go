@@ -0,0 +1,216 @@
+package orderbook
+
+import (
+	"testing"
+
+	"midnight-trader/models"
+)
+
+func limit(player, side string, price float64, quantity int) models.Order {
+	o := models.Order{
+		Player:   player,
+		Ticker:   "NMBS",
+		Side:     side,
+		Type:     "limit",
+		Price:    price,
+		Quantity: quantity,
+	}
+	if side == "buy" {
+		o.Reserved = price * float64(quantity)
+	}
+	return o
+}
+
+func submit(t *testing.T, e *Exchange, o models.Order) (models.Order, []Fill, []models.Order) {
+	t.Helper()
+	result, fills, completed, err := e.Submit(o)
+	if err != nil {
+		t.Fatalf("Submit(%+v): %v", o, err)
+	}
+	return result, fills, completed
+}
+
+func TestPriceTimePriority(t *testing.T) {
+	e := NewExchange()
+	late, _, _ := submit(t, e, limit("alice", "sell", 10, 5))
+	early, _, _ := submit(t, e, limit("bob", "sell", 10, 5))
+	cheap, _, _ := submit(t, e, limit("carol", "sell", 9, 5))
+	submit(t, e, limit("dave", "sell", 11, 5))
+
+	taker, fills, completed := submit(t, e, limit("erin", "buy", 10, 12))
+
+	want := []struct {
+		seller string
+		price  float64
+		qty    int
+	}{
+		{"carol", 9, 5},
+		{"alice", 10, 5},
+		{"bob", 10, 2},
+	}
+	if len(fills) != len(want) {
+		t.Fatalf("got %d fills, want %d", len(fills), len(want))
+	}
+	for i, w := range want {
+		f := fills[i]
+		if f.Sell.Player != w.seller || f.Price != w.price || f.Quantity != w.qty {
+			t.Errorf("fill %d = %s %v x %d, want %s %v x %d",
+				i, f.Sell.Player, f.Price, f.Quantity, w.seller, w.price, w.qty)
+		}
+	}
+
+	if len(completed) != 2 || completed[0].ID != cheap.ID || completed[1].ID != late.ID {
+		t.Errorf("completed = %+v, want the orders of carol and alice", completed)
+	}
+	if taker.Status != "filled" || taker.Filled != 12 {
+		t.Errorf("taker = %s with %d filled, want filled with 12", taker.Status, taker.Filled)
+	}
+	// The buyer paid less than its limit on the cheaper shares.
+	if want := 10*12 - (9*5 + 10*7); taker.Reserved != float64(want) {
+		t.Errorf("taker kept %v reserved, want %v", taker.Reserved, want)
+	}
+
+	rest, ok := e.Order(early.ID)
+	if !ok || rest.Status != "partial" || rest.Remaining() != 3 {
+		t.Errorf("bob's order = %+v, want partial with 3 remaining", rest)
+	}
+	_, asks := e.Depth("NMBS")
+	if len(asks) != 2 || asks[0] != (Level{Price: 10, Quantity: 3, Orders: 1}) {
+		t.Errorf("asks = %+v, want 3 at 10 ahead of 5 at 11", asks)
+	}
+}
+
+func TestPartialFillRests(t *testing.T) {
+	e := NewExchange()
+	maker, _, _ := submit(t, e, limit("alice", "buy", 20, 4))
+
+	taker, fills, completed := submit(t, e, limit("bob", "sell", 18, 10))
+	if len(fills) != 1 || fills[0].Quantity != 4 || fills[0].Price != 20 {
+		t.Fatalf("fills = %+v, want 4 at the maker's price of 20", fills)
+	}
+	if len(completed) != 1 || completed[0].ID != maker.ID || completed[0].Status != "filled" {
+		t.Errorf("completed = %+v, want alice's filled order", completed)
+	}
+	if taker.Status != "partial" || taker.Remaining() != 6 {
+		t.Errorf("taker = %s with %d remaining, want partial with 6", taker.Status, taker.Remaining())
+	}
+
+	bids, asks := e.Depth("NMBS")
+	if len(bids) != 0 {
+		t.Errorf("bids = %+v, want none", bids)
+	}
+	if len(asks) != 1 || asks[0] != (Level{Price: 18, Quantity: 6, Orders: 1}) {
+		t.Errorf("asks = %+v, want 6 at 18", asks)
+	}
+}
+
+func TestMarketOrderRemainderIsCancelled(t *testing.T) {
+	e := NewExchange()
+	submit(t, e, limit("alice", "sell", 10, 3))
+
+	order := models.Order{Player: "bob", Ticker: "NMBS", Side: "buy", Type: "market", Quantity: 5, Reserved: 1000}
+	taker, fills, _ := submit(t, e, order)
+	if len(fills) != 1 || fills[0].Quantity != 3 {
+		t.Fatalf("fills = %+v, want one of 3", fills)
+	}
+	if taker.Status != "cancelled" || taker.Filled != 3 {
+		t.Errorf("taker = %s with %d filled, want cancelled with 3", taker.Status, taker.Filled)
+	}
+	if _, ok := e.Order(taker.ID); ok {
+		t.Error("market order rests on the book")
+	}
+}
+
+func TestBuyerLimitedByReserve(t *testing.T) {
+	e := NewExchange()
+	submit(t, e, limit("alice", "sell", 10, 10))
+
+	order := models.Order{Player: "bob", Ticker: "NMBS", Side: "buy", Type: "market", Quantity: 10, Reserved: 45}
+	_, fills, _ := submit(t, e, order)
+	if len(fills) != 1 || fills[0].Quantity != 4 {
+		t.Fatalf("fills = %+v, want one of 4", fills)
+	}
+}
+
+func TestBuyerPaysFeeFromReserve(t *testing.T) {
+	e := NewExchange()
+	e.Fee = func(value float64) float64 { return 1 }
+	submit(t, e, limit("alice", "sell", 10, 10))
+
+	// 40 pays for 4 shares only with the fee left out.
+	order := models.Order{Player: "bob", Ticker: "NMBS", Side: "buy", Type: "market", Quantity: 10, Reserved: 40}
+	taker, fills, _ := submit(t, e, order)
+	if len(fills) != 1 || fills[0].Quantity != 3 || fills[0].Fee != 1 {
+		t.Fatalf("fills = %+v, want one of 3 with a fee of 1", fills)
+	}
+	if taker.Reserved != 9 {
+		t.Errorf("taker kept %v reserved, want 9", taker.Reserved)
+	}
+}
+
+func TestUnaffordableBidLeavesBook(t *testing.T) {
+	e := NewExchange()
+	e.Fee = func(value float64) float64 { return 1 }
+	// The first fill's fee leaves alice unable to pay for the rest.
+	first := limit("alice", "buy", 10, 2)
+	first.Reserved = 21
+	first, _, _ = submit(t, e, first)
+	second := limit("bob", "buy", 10, 2)
+	second.Reserved = 21
+	submit(t, e, second)
+	submit(t, e, limit("carol", "sell", 10, 1))
+
+	_, fills, completed := submit(t, e, limit("dave", "sell", 10, 2))
+	if len(fills) != 1 || fills[0].Buy.Player != "bob" || fills[0].Quantity != 2 {
+		t.Fatalf("fills = %+v, want 2 bought by bob", fills)
+	}
+	if len(completed) != 2 || completed[0].ID != first.ID || completed[0].Status != "cancelled" || completed[0].Reserved != 10 {
+		t.Errorf("completed = %+v, want alice's order cancelled with 10 reserved first", completed)
+	}
+}
+
+func TestOwnOrdersAreSkipped(t *testing.T) {
+	e := NewExchange()
+	submit(t, e, limit("alice", "sell", 9, 5))
+	submit(t, e, limit("bob", "sell", 10, 5))
+
+	_, fills, _ := submit(t, e, limit("alice", "buy", 10, 5))
+	if len(fills) != 1 || fills[0].Sell.Player != "bob" {
+		t.Fatalf("fills = %+v, want one against bob", fills)
+	}
+	_, asks := e.Depth("NMBS")
+	if len(asks) != 1 || asks[0].Price != 9 {
+		t.Errorf("asks = %+v, want alice's order at 9 untouched", asks)
+	}
+}
+
+func TestRevert(t *testing.T) {
+	e := NewExchange()
+	first, _, _ := submit(t, e, limit("alice", "buy", 12, 5))
+	second, _, _ := submit(t, e, limit("bob", "buy", 11, 5))
+
+	_, fills, completed := submit(t, e, limit("carol", "sell", 11, 7))
+	if len(fills) != 2 || len(completed) != 1 {
+		t.Fatalf("got %d fills and %d completed, want 2 and 1", len(fills), len(completed))
+	}
+
+	reverted := e.Revert(fills)
+	if len(reverted) != 2 {
+		t.Fatalf("reverted %d orders, want 2", len(reverted))
+	}
+	for _, want := range []models.Order{first, second} {
+		got, ok := e.Order(want.ID)
+		if !ok {
+			t.Errorf("order %s is not back on the book", want.Player)
+			continue
+		}
+		if got.Status != "open" || got.Filled != 0 || got.Reserved != want.Reserved {
+			t.Errorf("%s's order = %s, %d filled, %v reserved, want open, 0, %v",
+				want.Player, got.Status, got.Filled, got.Reserved, want.Reserved)
+		}
+	}
+	bids, _ := e.Depth("NMBS")
+	if len(bids) != 2 || bids[0].Price != 12 || bids[1].Price != 11 {
+		t.Errorf("bids = %+v, want 12 ahead of 11", bids)
+	}
+}
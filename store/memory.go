@@ -0,0 +1,661 @@
+package store
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"midnight-trader/models"
+)
+
+// MemoryStore implements Store entirely in process memory. It is intended for
+// local development and tests; all data is lost when the process exits.
+type MemoryStore struct {
+	// TickInterval spaces the ticks of prices stored together; zero means
+	// DefaultTickInterval.
+	TickInterval time.Duration
+
+	mu           sync.RWMutex
+	companies    []models.Company
+	ticks        []models.PriceTick
+	portfolios   []models.Portfolio
+	trades       []models.Trade
+	transactions []models.Trade
+	orders       []models.Order
+	conditional  []models.ConditionalOrder
+	news         []models.News
+	equity       []models.EquitySnapshot
+	rounds       []models.RoundState
+	accounts     []models.Account
+	audit        []models.AuditEntry
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Values handed out by the store are copied so callers can never mutate
+// stored state without going through the interface.
+
+func copyCompany(c models.Company) models.Company {
+	c.HistoricalStockPrices = slices.Clone(c.HistoricalStockPrices)
+	return c
+}
+
+func copyPortfolio(p models.Portfolio) models.Portfolio {
+	p.Companies = maps.Clone(p.Companies)
+	if p.Companies == nil {
+		p.Companies = make(map[string]int)
+	}
+	p.ReservedShares = maps.Clone(p.ReservedShares)
+	return p
+}
+
+func copyRound(r models.RoundState) models.RoundState {
+	participants := make([]models.Portfolio, len(r.Participants))
+	for i, p := range r.Participants {
+		participants[i] = copyPortfolio(p)
+	}
+	r.Participants = participants
+	if r.Winner != nil {
+		winner := copyPortfolio(*r.Winner)
+		r.Winner = &winner
+	}
+	leaderboard := make([]models.Standing, len(r.Leaderboard))
+	for i, st := range r.Leaderboard {
+		st.Companies = maps.Clone(st.Companies)
+		leaderboard[i] = st
+	}
+	r.Leaderboard = leaderboard
+	r.StartPrices = maps.Clone(r.StartPrices)
+	r.EndPrices = maps.Clone(r.EndPrices)
+	return r
+}
+
+func filterTrades(trades []models.Trade, player string) []models.Trade {
+	var out []models.Trade
+	for _, t := range trades {
+		if player == "" || t.Player == player {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func (s *MemoryStore) companyIndex(ticker string) int {
+	return slices.IndexFunc(s.companies, func(c models.Company) bool { return c.Ticker == ticker })
+}
+
+func (s *MemoryStore) portfolioIndex(player string) int {
+	return slices.IndexFunc(s.portfolios, func(p models.Portfolio) bool { return p.Player == player })
+}
+
+func (s *MemoryStore) ListCompanies(ctx context.Context) ([]models.Company, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []models.Company
+	for _, c := range s.companies {
+		out = append(out, copyCompany(c))
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) GetCompany(ctx context.Context, ticker string) (*models.Company, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := s.companyIndex(ticker)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	company := copyCompany(s.companies[i])
+	return &company, nil
+}
+
+func (s *MemoryStore) ReplaceCompanies(ctx context.Context, companies []models.Company) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.companies = nil
+	s.ticks = nil
+	for _, c := range companies {
+		s.companies = append(s.companies, copyCompany(c))
+		s.recordTicks(c.Ticker, c.HistoricalStockPrices)
+	}
+	return nil
+}
+
+// recordTicks stores prices as ticks of ticker leading up to the current
+// time. Callers must hold mu.
+func (s *MemoryStore) recordTicks(ticker string, prices []float64) {
+	if len(prices) == 0 {
+		return
+	}
+	var last time.Time
+	for i := len(s.ticks) - 1; i >= 0; i-- {
+		if s.ticks[i].Ticker == ticker {
+			last = s.ticks[i].Time
+			break
+		}
+	}
+	times := tickTimes(len(prices), last, time.Now(), s.TickInterval)
+	for i, price := range prices {
+		s.ticks = append(s.ticks, models.PriceTick{Ticker: ticker, Price: price, Time: times[i]})
+	}
+}
+
+func (s *MemoryStore) SetCompanyPrices(ctx context.Context, ticker string, prices []float64) error {
+	if len(prices) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.companyIndex(ticker)
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.companies[i].HistoricalStockPrices = slices.Clone(prices)
+	s.companies[i].StockPrice = prices[len(prices)-1]
+	s.ticks = slices.DeleteFunc(s.ticks, func(t models.PriceTick) bool { return t.Ticker == ticker })
+	s.recordTicks(ticker, prices)
+	return nil
+}
+
+func (s *MemoryStore) AppendCompanyPrices(ctx context.Context, ticker string, prices []float64) error {
+	if len(prices) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.companyIndex(ticker)
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.companies[i].HistoricalStockPrices = append(s.companies[i].HistoricalStockPrices, prices...)
+	s.companies[i].StockPrice = prices[len(prices)-1]
+	s.recordTicks(ticker, prices)
+	return nil
+}
+
+func (s *MemoryStore) ListPriceTicks(ctx context.Context, ticker string, since time.Time) ([]models.PriceTick, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]models.PriceTick, 0)
+	for _, t := range s.ticks {
+		if t.Ticker == ticker && !t.Time.Before(since) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) ClearCompanies(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.companies = nil
+	s.ticks = nil
+	return nil
+}
+
+func (s *MemoryStore) ListPortfolios(ctx context.Context) ([]models.Portfolio, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []models.Portfolio
+	for _, p := range s.portfolios {
+		out = append(out, copyPortfolio(p))
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) GetPortfolio(ctx context.Context, player string) (*models.Portfolio, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := s.portfolioIndex(player)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	portfolio := copyPortfolio(s.portfolios[i])
+	return &portfolio, nil
+}
+
+func (s *MemoryStore) CreatePortfolio(ctx context.Context, portfolio models.Portfolio) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.portfolioIndex(portfolio.Player) >= 0 {
+		return ErrDuplicate
+	}
+	s.portfolios = append(s.portfolios, copyPortfolio(portfolio))
+	return nil
+}
+
+func (s *MemoryStore) SavePortfolio(ctx context.Context, portfolio models.Portfolio) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Mirrors ReplaceOne without upsert: saving an unknown player is a no-op.
+	if i := s.portfolioIndex(portfolio.Player); i >= 0 {
+		s.portfolios[i] = copyPortfolio(portfolio)
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeletePortfolio(ctx context.Context, player string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.portfolioIndex(player); i >= 0 {
+		s.portfolios = slices.Delete(s.portfolios, i, i+1)
+	}
+	return nil
+}
+
+func (s *MemoryStore) ClearPortfolios(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.portfolios = nil
+	return nil
+}
+
+func (s *MemoryStore) InsertTrade(ctx context.Context, trade models.Trade) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.trades = append(s.trades, trade)
+	return nil
+}
+
+func (s *MemoryStore) ListTrades(ctx context.Context, player string) ([]models.Trade, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return filterTrades(s.trades, player), nil
+}
+
+func (s *MemoryStore) ListTickerTrades(ctx context.Context, ticker string, since time.Time) ([]models.Trade, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]models.Trade, 0)
+	for _, t := range s.trades {
+		if t.Ticker == ticker && !t.Timestamp.Before(since) {
+			out = append(out, t)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Timestamp.Before(out[j].Timestamp) })
+	return out, nil
+}
+
+func (s *MemoryStore) LogTransaction(ctx context.Context, trade models.Trade) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.transactions = append(s.transactions, trade)
+	return nil
+}
+
+func (s *MemoryStore) ListTransactions(ctx context.Context, player string) ([]models.Trade, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return filterTrades(s.transactions, player), nil
+}
+
+func (s *MemoryStore) ClearTrades(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.trades = nil
+	return nil
+}
+
+func (s *MemoryStore) SaveOrder(ctx context.Context, order models.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.orders, func(o models.Order) bool { return o.ID == order.ID })
+	if i >= 0 {
+		s.orders[i] = order
+	} else {
+		s.orders = append(s.orders, order)
+	}
+	return nil
+}
+
+func (s *MemoryStore) ListOrders(ctx context.Context, player string) ([]models.Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []models.Order
+	for _, o := range s.orders {
+		if player == "" || o.Player == player {
+			out = append(out, o)
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) ListOpenOrders(ctx context.Context) ([]models.Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []models.Order
+	for _, o := range s.orders {
+		if o.IsOpen() {
+			out = append(out, o)
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) ClearOrders(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.orders = nil
+	return nil
+}
+
+func (s *MemoryStore) SaveConditionalOrder(ctx context.Context, order models.ConditionalOrder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.conditional, func(o models.ConditionalOrder) bool { return o.ID == order.ID })
+	if i >= 0 {
+		s.conditional[i] = order
+	} else {
+		s.conditional = append(s.conditional, order)
+	}
+	return nil
+}
+
+func (s *MemoryStore) ListConditionalOrders(ctx context.Context, player string) ([]models.ConditionalOrder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []models.ConditionalOrder
+	for _, o := range s.conditional {
+		if player == "" || o.Player == player {
+			out = append(out, o)
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) ListPendingConditionalOrders(ctx context.Context) ([]models.ConditionalOrder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []models.ConditionalOrder
+	for _, o := range s.conditional {
+		if o.Status == "pending" {
+			out = append(out, o)
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) ClearConditionalOrders(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conditional = nil
+	return nil
+}
+
+func (s *MemoryStore) InsertNews(ctx context.Context, news models.News) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	news.Prices = maps.Clone(news.Prices)
+	s.news = append(s.news, news)
+	return nil
+}
+
+func (s *MemoryStore) ListNews(ctx context.Context, limit int) ([]models.News, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]models.News, 0, min(limit, len(s.news)))
+	for i := len(s.news) - 1; i >= 0 && len(out) < limit; i-- {
+		news := s.news[i]
+		news.Prices = maps.Clone(news.Prices)
+		out = append(out, news)
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) ClearNews(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.news = nil
+	return nil
+}
+
+func (s *MemoryStore) InsertEquity(ctx context.Context, snapshots []models.EquitySnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.equity = append(s.equity, snapshots...)
+	return nil
+}
+
+func (s *MemoryStore) ListEquity(ctx context.Context, player string) ([]models.EquitySnapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]models.EquitySnapshot, 0)
+	for _, snapshot := range s.equity {
+		if player == "" || snapshot.Player == player {
+			out = append(out, snapshot)
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) ClearEquity(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.equity = nil
+	return nil
+}
+
+func (s *MemoryStore) SaveRound(ctx context.Context, round models.RoundState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	round = copyRound(round)
+	i := slices.IndexFunc(s.rounds, func(r models.RoundState) bool { return r.ID == round.ID })
+	if i >= 0 {
+		s.rounds[i] = round
+	} else {
+		s.rounds = append(s.rounds, round)
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetRound(ctx context.Context, id int) (*models.RoundState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := slices.IndexFunc(s.rounds, func(r models.RoundState) bool { return r.ID == id })
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	round := copyRound(s.rounds[i])
+	return &round, nil
+}
+
+func (s *MemoryStore) ListRounds(ctx context.Context) ([]models.RoundState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []models.RoundState
+	for _, r := range s.rounds {
+		out = append(out, copyRound(r))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return out, nil
+}
+
+func (s *MemoryStore) CreateAccount(ctx context.Context, account models.Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if slices.ContainsFunc(s.accounts, func(a models.Account) bool { return a.Username == account.Username }) {
+		return ErrDuplicate
+	}
+	s.accounts = append(s.accounts, account)
+	return nil
+}
+
+func (s *MemoryStore) GetAccount(ctx context.Context, username string) (*models.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := slices.IndexFunc(s.accounts, func(a models.Account) bool { return a.Username == username })
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	account := s.accounts[i]
+	return &account, nil
+}
+
+func (s *MemoryStore) SaveAccount(ctx context.Context, account models.Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.accounts, func(a models.Account) bool { return a.Username == account.Username })
+	if i < 0 {
+		s.accounts = append(s.accounts, account)
+	} else {
+		s.accounts[i] = account
+	}
+	return nil
+}
+
+func (s *MemoryStore) RecordAudit(ctx context.Context, entry models.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.audit = append(s.audit, entry)
+	return nil
+}
+
+func (s *MemoryStore) ListAudit(ctx context.Context, limit int) ([]models.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]models.AuditEntry, 0, min(limit, len(s.audit)))
+	for i := len(s.audit) - 1; i >= 0 && len(out) < limit; i-- {
+		out = append(out, s.audit[i])
+	}
+	return out, nil
+}
+
+// applyChange applies c to p in place, failing without modifying p if any
+// guarded balance would go negative.
+func applyChange(p *models.Portfolio, c PortfolioChange) error {
+	if err := checkGuards(p, c); err != nil && !c.Unguarded {
+		return err
+	}
+
+	p.Funds += c.Funds
+	p.ReservedFunds += c.ReservedFunds
+	p.Loan += c.Loan
+	p.FeesPaid += c.Fees
+	p.Companies = addShares(p.Companies, c.Shares)
+	p.ReservedShares = addShares(p.ReservedShares, c.ReservedShares)
+	return nil
+}
+
+// checkGuards reports ErrInsufficient if c would take a guarded balance of p
+// below zero.
+func checkGuards(p *models.Portfolio, c PortfolioChange) error {
+	if c.Funds < 0 && p.Funds+c.Funds < -moneyEpsilon {
+		return ErrInsufficient
+	}
+	if c.ReservedFunds < 0 && p.ReservedFunds+c.ReservedFunds < -moneyEpsilon {
+		return ErrInsufficient
+	}
+	if c.Loan < 0 && p.Loan+c.Loan < -moneyEpsilon {
+		return ErrInsufficient
+	}
+	for ticker, n := range c.Shares {
+		if n < 0 && p.Companies[ticker]+n < 0 && !c.AllowShort {
+			return ErrInsufficient
+		}
+	}
+	for ticker, n := range c.ReservedShares {
+		if n < 0 && p.ReservedShares[ticker]+n < 0 {
+			return ErrInsufficient
+		}
+	}
+	return nil
+}
+
+// addShares adds delta to holdings, dropping tickers that reach zero.
+func addShares(holdings, delta map[string]int) map[string]int {
+	if len(delta) == 0 {
+		return holdings
+	}
+	if holdings == nil {
+		holdings = make(map[string]int)
+	}
+	for ticker, n := range delta {
+		holdings[ticker] += n
+		if holdings[ticker] == 0 {
+			delete(holdings, ticker)
+		}
+	}
+	return holdings
+}
+
+func (s *MemoryStore) ApplyBatch(ctx context.Context, batch Batch) ([]models.Portfolio, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Work on copies so a failed guard leaves the store untouched.
+	working := make(map[string]*models.Portfolio)
+	for _, c := range batch.Changes {
+		p, ok := working[c.Player]
+		if !ok {
+			i := s.portfolioIndex(c.Player)
+			if i < 0 {
+				return nil, ErrNotFound
+			}
+			cp := copyPortfolio(s.portfolios[i])
+			p = &cp
+			working[c.Player] = p
+		}
+		if err := applyChange(p, c); err != nil {
+			return nil, err
+		}
+	}
+
+	for player, p := range working {
+		s.portfolios[s.portfolioIndex(player)] = *p
+	}
+	s.trades = append(s.trades, batch.Trades...)
+	s.transactions = append(s.transactions, batch.Transactions...)
+
+	out := make([]models.Portfolio, len(batch.Changes))
+	for i, c := range batch.Changes {
+		out[i] = copyPortfolio(*working[c.Player])
+	}
+	return out, nil
+}
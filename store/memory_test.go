@@ -0,0 +1,280 @@
+package store
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"midnight-trader/models"
+)
+
+func newTestStore(t *testing.T, players ...string) *MemoryStore {
+	t.Helper()
+	s := NewMemoryStore()
+	for _, player := range players {
+		err := s.CreatePortfolio(context.Background(), models.Portfolio{
+			Player:    player,
+			Funds:     1000,
+			Companies: map[string]int{"NMBS": 10},
+		})
+		if err != nil {
+			t.Fatalf("CreatePortfolio(%s): %v", player, err)
+		}
+	}
+	return s
+}
+
+func trade(player, side string) models.Trade {
+	return models.Trade{Player: player, Ticker: "NMBS", Type: side, Amount: 1, Price: 10, Timestamp: time.Now()}
+}
+
+func mustPortfolio(t *testing.T, s *MemoryStore, player string) models.Portfolio {
+	t.Helper()
+	p, err := s.GetPortfolio(context.Background(), player)
+	if err != nil {
+		t.Fatalf("GetPortfolio(%s): %v", player, err)
+	}
+	return *p
+}
+
+func TestApplyBatch(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, "alice", "bob")
+
+	updated, err := s.ApplyBatch(ctx, Batch{
+		Changes: []PortfolioChange{
+			{Player: "alice", Funds: -100, Shares: map[string]int{"NMBS": 10}},
+			{Player: "bob", Funds: 100, Shares: map[string]int{"NMBS": -10}},
+		},
+		Trades:       []models.Trade{trade("alice", "buy"), trade("bob", "sell")},
+		Transactions: []models.Trade{trade("alice", "buy"), trade("bob", "sell")},
+	})
+	if err != nil {
+		t.Fatalf("ApplyBatch: %v", err)
+	}
+	if len(updated) != 2 || updated[0].Player != "alice" || updated[1].Player != "bob" {
+		t.Fatalf("updated = %+v, want alice then bob", updated)
+	}
+	if updated[0].Funds != 900 || updated[0].Companies["NMBS"] != 20 {
+		t.Errorf("alice = %+v, want 900 funds and 20 shares", updated[0])
+	}
+	// A position that reaches zero is dropped.
+	if _, ok := updated[1].Companies["NMBS"]; ok || updated[1].Funds != 1100 {
+		t.Errorf("bob = %+v, want 1100 funds and no shares", updated[1])
+	}
+
+	trades, _ := s.ListTrades(ctx, "")
+	transactions, _ := s.ListTransactions(ctx, "bob")
+	if len(trades) != 2 || len(transactions) != 1 {
+		t.Errorf("got %d trades and %d of bob's transactions, want 2 and 1", len(trades), len(transactions))
+	}
+}
+
+func TestApplyBatchInsufficientWritesNothing(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, "alice", "bob")
+	before := []models.Portfolio{mustPortfolio(t, s, "alice"), mustPortfolio(t, s, "bob")}
+
+	failing := []Batch{
+		// The second change of the same player overdraws the first.
+		{Changes: []PortfolioChange{
+			{Player: "alice", Funds: -600},
+			{Player: "alice", Funds: -600},
+		}},
+		{Changes: []PortfolioChange{
+			{Player: "alice", Funds: 50, Shares: map[string]int{"NMBS": 5}},
+			{Player: "bob", Shares: map[string]int{"NMBS": -11}},
+		}},
+		{Changes: []PortfolioChange{
+			{Player: "bob", ReservedShares: map[string]int{"NMBS": -1}},
+		}},
+		{Changes: []PortfolioChange{
+			{Player: "bob", ReservedFunds: -1},
+		}},
+		{Changes: []PortfolioChange{
+			{Player: "bob", Loan: -1},
+		}},
+	}
+	for i, batch := range failing {
+		batch.Trades = []models.Trade{trade("alice", "buy")}
+		batch.Transactions = []models.Trade{trade("alice", "buy")}
+		if _, err := s.ApplyBatch(ctx, batch); err != ErrInsufficient {
+			t.Errorf("batch %d: got %v, want ErrInsufficient", i, err)
+		}
+	}
+
+	_, err := s.ApplyBatch(ctx, Batch{
+		Changes: []PortfolioChange{{Player: "alice", Funds: -1}, {Player: "carol", Funds: 1}},
+		Trades:  []models.Trade{trade("alice", "buy")},
+	})
+	if err != ErrNotFound {
+		t.Errorf("batch with a missing portfolio: got %v, want ErrNotFound", err)
+	}
+
+	after := []models.Portfolio{mustPortfolio(t, s, "alice"), mustPortfolio(t, s, "bob")}
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("portfolios changed from %+v to %+v", before, after)
+	}
+	trades, _ := s.ListTrades(ctx, "")
+	transactions, _ := s.ListTransactions(ctx, "")
+	if len(trades) != 0 || len(transactions) != 0 {
+		t.Errorf("got %d trades and %d transactions, want none", len(trades), len(transactions))
+	}
+}
+
+func TestApplyBatchUnguarded(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, "alice")
+
+	updated, err := s.ApplyBatch(ctx, Batch{Changes: []PortfolioChange{
+		{Player: "alice", Funds: -1500, Fees: 1500, Unguarded: true},
+		{Player: "alice", Shares: map[string]int{"NMBS": -15}, AllowShort: true},
+	}})
+	if err != nil {
+		t.Fatalf("ApplyBatch: %v", err)
+	}
+	if p := updated[1]; p.Funds != -500 || p.FeesPaid != 1500 || p.Companies["NMBS"] != -5 {
+		t.Errorf("alice = %+v, want -500 funds, 1500 fees and -5 shares", p)
+	}
+}
+
+func TestApplyBatchConcurrent(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, "alice")
+
+	// 1000 in funds pays for exactly 100 shares at 10.
+	const workers, attempts = 20, 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	bought := 0
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range attempts {
+				_, err := s.ApplyBatch(ctx, Batch{
+					Changes: []PortfolioChange{{Player: "alice", Funds: -20, Shares: map[string]int{"NMBS": 2}}},
+					Trades:  []models.Trade{trade("alice", "buy")},
+				})
+				if err == nil {
+					mu.Lock()
+					bought++
+					mu.Unlock()
+				} else if err != ErrInsufficient {
+					t.Errorf("ApplyBatch: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	p := mustPortfolio(t, s, "alice")
+	if bought != 50 || p.Funds != 0 || p.Companies["NMBS"] != 110 {
+		t.Errorf("%d batches applied leaving %+v, want 50 leaving 0 funds and 110 shares", bought, p)
+	}
+	trades, _ := s.ListTrades(ctx, "alice")
+	if len(trades) != bought {
+		t.Errorf("got %d trades, want %d", len(trades), bought)
+	}
+}
+
+func TestReadsReturnCopies(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, "alice")
+	if err := s.ReplaceCompanies(ctx, []models.Company{{Ticker: "NMBS", StockPrice: 10, HistoricalStockPrices: []float64{10}}}); err != nil {
+		t.Fatalf("ReplaceCompanies: %v", err)
+	}
+
+	p := mustPortfolio(t, s, "alice")
+	p.Companies["NMBS"] = 99
+	company, err := s.GetCompany(ctx, "NMBS")
+	if err != nil {
+		t.Fatalf("GetCompany: %v", err)
+	}
+	company.HistoricalStockPrices[0] = 99
+
+	if got := mustPortfolio(t, s, "alice").Companies["NMBS"]; got != 10 {
+		t.Errorf("stored shares = %d after editing a copy, want 10", got)
+	}
+	if company, _ := s.GetCompany(ctx, "NMBS"); company.HistoricalStockPrices[0] != 10 {
+		t.Errorf("stored history = %v after editing a copy, want [10]", company.HistoricalStockPrices)
+	}
+}
+
+func TestCreatePortfolioDuplicate(t *testing.T) {
+	s := newTestStore(t, "alice")
+	err := s.CreatePortfolio(context.Background(), models.Portfolio{Player: "alice"})
+	if err != ErrDuplicate {
+		t.Errorf("got %v, want ErrDuplicate", err)
+	}
+	if _, err := s.GetPortfolio(context.Background(), "bob"); err != ErrNotFound {
+		t.Errorf("GetPortfolio of a missing player: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestPriceTickTimes(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	s.TickInterval = time.Minute
+	err := s.ReplaceCompanies(ctx, []models.Company{{Ticker: "NMBS", HistoricalStockPrices: []float64{1, 2, 3}}})
+	if err != nil {
+		t.Fatalf("ReplaceCompanies: %v", err)
+	}
+	if err := s.AppendCompanyPrices(ctx, "NMBS", []float64{4, 5}); err != nil {
+		t.Fatalf("AppendCompanyPrices: %v", err)
+	}
+
+	ticks, err := s.ListPriceTicks(ctx, "NMBS", time.Time{})
+	if err != nil {
+		t.Fatalf("ListPriceTicks: %v", err)
+	}
+	if len(ticks) != 5 {
+		t.Fatalf("got %d ticks, want 5", len(ticks))
+	}
+	for i, tick := range ticks {
+		if tick.Price != float64(i+1) {
+			t.Errorf("tick %d has price %v, want %v", i, tick.Price, i+1)
+		}
+		if i > 0 && !tick.Time.After(ticks[i-1].Time) {
+			t.Errorf("tick %d at %v is not after tick %d at %v", i, tick.Time, i-1, ticks[i-1].Time)
+		}
+	}
+	// The history is spaced by the interval; the appended prices are
+	// squeezed in after it.
+	if got := ticks[2].Time.Sub(ticks[0].Time); got != 2*time.Minute {
+		t.Errorf("history spans %v, want 2m", got)
+	}
+	if got := ticks[4].Time.Sub(ticks[2].Time); got >= time.Minute {
+		t.Errorf("appended prices span %v, want less than the interval", got)
+	}
+
+	since, err := s.ListPriceTicks(ctx, "NMBS", ticks[3].Time)
+	if err != nil || len(since) != 2 {
+		t.Errorf("got %d ticks since the fourth (%v), want 2", len(since), err)
+	}
+}
+
+func TestListTickerTrades(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, "alice")
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	trades := []models.Trade{
+		{Player: "alice", Ticker: "NMBS", Amount: 3, Timestamp: start.Add(2 * time.Minute)},
+		{Player: "alice", Ticker: "QTX", Amount: 1, Timestamp: start.Add(3 * time.Minute)},
+		{Player: "alice", Ticker: "NMBS", Amount: 2, Timestamp: start.Add(time.Minute)},
+		{Player: "alice", Ticker: "NMBS", Amount: 1, Timestamp: start},
+	}
+	if _, err := s.ApplyBatch(ctx, Batch{Trades: trades}); err != nil {
+		t.Fatalf("ApplyBatch: %v", err)
+	}
+
+	got, err := s.ListTickerTrades(ctx, "NMBS", start.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("ListTickerTrades: %v", err)
+	}
+	if len(got) != 2 || got[0].Amount != 2 || got[1].Amount != 3 {
+		t.Errorf("got %+v, want the NMBS trades from the first minute on, oldest first", got)
+	}
+}
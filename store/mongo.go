@@ -0,0 +1,754 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"midnight-trader/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore implements Store on top of a MongoDB database.
+type MongoStore struct {
+	// TickInterval spaces the ticks of prices stored together; zero means
+	// DefaultTickInterval.
+	TickInterval time.Duration
+
+	client       *mongo.Client
+	companies    *mongo.Collection
+	ticks        *mongo.Collection
+	portfolios   *mongo.Collection
+	trades       *mongo.Collection
+	transactions *mongo.Collection
+	orders       *mongo.Collection
+	conditional  *mongo.Collection
+	news         *mongo.Collection
+	equity       *mongo.Collection
+	rounds       *mongo.Collection
+	accounts     *mongo.Collection
+	audit        *mongo.Collection
+}
+
+// NewMongoStore returns a MongoStore backed by db and ensures its indexes exist.
+func NewMongoStore(ctx context.Context, db *mongo.Database) (*MongoStore, error) {
+	s := &MongoStore{
+		client:       db.Client(),
+		companies:    db.Collection("companies"),
+		ticks:        db.Collection("price_ticks"),
+		portfolios:   db.Collection("portfolios"),
+		trades:       db.Collection("trades"),
+		transactions: db.Collection("transactions"),
+		orders:       db.Collection("orders"),
+		conditional:  db.Collection("conditional_orders"),
+		news:         db.Collection("news"),
+		equity:       db.Collection("equity"),
+		rounds:       db.Collection("rounds"),
+		accounts:     db.Collection("accounts"),
+		audit:        db.Collection("audit"),
+	}
+
+	// Create a unique index on the "player" field
+	indexModel := mongo.IndexModel{
+		Keys:    bson.M{"player": 1},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := s.portfolios.Indexes().CreateOne(ctx, indexModel); err != nil {
+		return nil, fmt.Errorf("failed to create unique index on player field: %v", err)
+	}
+
+	roundIndex := mongo.IndexModel{
+		Keys:    bson.M{"id": 1},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := s.rounds.Indexes().CreateOne(ctx, roundIndex); err != nil {
+		return nil, fmt.Errorf("failed to create unique index on round id: %v", err)
+	}
+
+	tickIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "ticker", Value: 1}, {Key: "time", Value: 1}},
+	}
+	if _, err := s.ticks.Indexes().CreateOne(ctx, tickIndex); err != nil {
+		return nil, fmt.Errorf("failed to create index on price ticks: %v", err)
+	}
+
+	tradeIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "ticker", Value: 1}, {Key: "timestamp", Value: 1}},
+	}
+	if _, err := s.trades.Indexes().CreateOne(ctx, tradeIndex); err != nil {
+		return nil, fmt.Errorf("failed to create index on trades: %v", err)
+	}
+
+	accountIndex := mongo.IndexModel{
+		Keys:    bson.M{"username": 1},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := s.accounts.Indexes().CreateOne(ctx, accountIndex); err != nil {
+		return nil, fmt.Errorf("failed to create unique index on username: %v", err)
+	}
+
+	return s, nil
+}
+
+// decodeAll drains a cursor into a slice of T.
+func decodeAll[T any](ctx context.Context, cursor *mongo.Cursor) ([]T, error) {
+	defer cursor.Close(ctx)
+
+	var out []T
+	for cursor.Next(ctx) {
+		var item T
+		if err := cursor.Decode(&item); err != nil {
+			return nil, fmt.Errorf("failed to decode document: %v", err)
+		}
+		out = append(out, item)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %v", err)
+	}
+	return out, nil
+}
+
+func (s *MongoStore) ListCompanies(ctx context.Context) ([]models.Company, error) {
+	cursor, err := s.companies.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch companies: %v", err)
+	}
+	return decodeAll[models.Company](ctx, cursor)
+}
+
+func (s *MongoStore) GetCompany(ctx context.Context, ticker string) (*models.Company, error) {
+	var company models.Company
+	err := s.companies.FindOne(ctx, bson.M{"ticker": ticker}).Decode(&company)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch company: %v", err)
+	}
+	return &company, nil
+}
+
+func (s *MongoStore) ReplaceCompanies(ctx context.Context, companies []models.Company) error {
+	if err := s.companies.Drop(ctx); err != nil {
+		return fmt.Errorf("failed to drop existing companies: %v", err)
+	}
+	if _, err := s.ticks.DeleteMany(ctx, bson.M{}); err != nil {
+		return fmt.Errorf("failed to drop existing price ticks: %v", err)
+	}
+	if len(companies) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, len(companies))
+	for i, company := range companies {
+		docs[i] = company
+	}
+	if _, err := s.companies.InsertMany(ctx, docs); err != nil {
+		return fmt.Errorf("failed to insert companies: %v", err)
+	}
+	for _, company := range companies {
+		if err := s.recordTicks(ctx, company.Ticker, company.HistoricalStockPrices); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordTicks stores prices as ticks of ticker leading up to the current
+// time.
+func (s *MongoStore) recordTicks(ctx context.Context, ticker string, prices []float64) error {
+	if len(prices) == 0 {
+		return nil
+	}
+	var last models.PriceTick
+	opts := options.FindOne().SetSort(bson.D{{Key: "time", Value: -1}})
+	err := s.ticks.FindOne(ctx, bson.M{"ticker": ticker}, opts).Decode(&last)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return fmt.Errorf("failed to fetch latest price tick for %s: %v", ticker, err)
+	}
+
+	times := tickTimes(len(prices), last.Time, time.Now(), s.TickInterval)
+	docs := make([]interface{}, len(prices))
+	for i, price := range prices {
+		docs[i] = models.PriceTick{Ticker: ticker, Price: price, Time: times[i]}
+	}
+	if _, err := s.ticks.InsertMany(ctx, docs); err != nil {
+		return fmt.Errorf("failed to record price ticks for %s: %v", ticker, err)
+	}
+	return nil
+}
+
+func (s *MongoStore) ListPriceTicks(ctx context.Context, ticker string, since time.Time) ([]models.PriceTick, error) {
+	filter := bson.M{"ticker": ticker, "time": bson.M{"$gte": since}}
+	opts := options.Find().SetSort(bson.D{{Key: "time", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := s.ticks.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch price ticks: %v", err)
+	}
+	return decodeAll[models.PriceTick](ctx, cursor)
+}
+
+func (s *MongoStore) SetCompanyPrices(ctx context.Context, ticker string, prices []float64) error {
+	if len(prices) == 0 {
+		return nil
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"historicalStockPrices": prices,
+			"stockPrice":            prices[len(prices)-1],
+		},
+	}
+	if err := s.updateCompany(ctx, ticker, update); err != nil {
+		return err
+	}
+	if _, err := s.ticks.DeleteMany(ctx, bson.M{"ticker": ticker}); err != nil {
+		return fmt.Errorf("failed to drop price ticks for %s: %v", ticker, err)
+	}
+	return s.recordTicks(ctx, ticker, prices)
+}
+
+func (s *MongoStore) AppendCompanyPrices(ctx context.Context, ticker string, prices []float64) error {
+	if len(prices) == 0 {
+		return nil
+	}
+	update := bson.M{
+		"$push": bson.M{"historicalStockPrices": bson.M{"$each": prices}},
+		"$set":  bson.M{"stockPrice": prices[len(prices)-1]},
+	}
+	if err := s.updateCompany(ctx, ticker, update); err != nil {
+		return err
+	}
+	return s.recordTicks(ctx, ticker, prices)
+}
+
+func (s *MongoStore) updateCompany(ctx context.Context, ticker string, update bson.M) error {
+	res, err := s.companies.UpdateOne(ctx, bson.M{"ticker": ticker}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update company %s: %v", ticker, err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) ClearCompanies(ctx context.Context) error {
+	if err := s.companies.Drop(ctx); err != nil {
+		return fmt.Errorf("failed to clear companies: %v", err)
+	}
+	if _, err := s.ticks.DeleteMany(ctx, bson.M{}); err != nil {
+		return fmt.Errorf("failed to clear price ticks: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) ListPortfolios(ctx context.Context) ([]models.Portfolio, error) {
+	cursor, err := s.portfolios.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch portfolios: %v", err)
+	}
+	return decodeAll[models.Portfolio](ctx, cursor)
+}
+
+func (s *MongoStore) GetPortfolio(ctx context.Context, player string) (*models.Portfolio, error) {
+	var portfolio models.Portfolio
+	err := s.portfolios.FindOne(ctx, bson.M{"player": player}).Decode(&portfolio)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch portfolio: %v", err)
+	}
+	return &portfolio, nil
+}
+
+func (s *MongoStore) CreatePortfolio(ctx context.Context, portfolio models.Portfolio) error {
+	_, err := s.portfolios.InsertOne(ctx, portfolio)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create new portfolio: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) SavePortfolio(ctx context.Context, portfolio models.Portfolio) error {
+	_, err := s.portfolios.ReplaceOne(ctx, bson.M{"player": portfolio.Player}, portfolio)
+	if err != nil {
+		return fmt.Errorf("failed to save portfolio: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) DeletePortfolio(ctx context.Context, player string) error {
+	if _, err := s.portfolios.DeleteOne(ctx, bson.M{"player": player}); err != nil {
+		return fmt.Errorf("failed to delete portfolio: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) ClearPortfolios(ctx context.Context) error {
+	if err := s.portfolios.Drop(ctx); err != nil {
+		return fmt.Errorf("failed to clear portfolios: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) InsertTrade(ctx context.Context, trade models.Trade) error {
+	if _, err := s.trades.InsertOne(ctx, trade); err != nil {
+		return fmt.Errorf("failed to log trade: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) ListTrades(ctx context.Context, player string) ([]models.Trade, error) {
+	return s.listTrades(ctx, s.trades, player)
+}
+
+func (s *MongoStore) ListTickerTrades(ctx context.Context, ticker string, since time.Time) ([]models.Trade, error) {
+	filter := bson.M{"ticker": ticker, "timestamp": bson.M{"$gte": since}}
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}})
+	cursor, err := s.trades.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch trades: %v", err)
+	}
+	return decodeAll[models.Trade](ctx, cursor)
+}
+
+func (s *MongoStore) LogTransaction(ctx context.Context, trade models.Trade) error {
+	if _, err := s.transactions.InsertOne(ctx, trade); err != nil {
+		return fmt.Errorf("failed to log transaction: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) ListTransactions(ctx context.Context, player string) ([]models.Trade, error) {
+	return s.listTrades(ctx, s.transactions, player)
+}
+
+func (s *MongoStore) listTrades(ctx context.Context, coll *mongo.Collection, player string) ([]models.Trade, error) {
+	filter := bson.M{}
+	if player != "" {
+		filter["player"] = player
+	}
+	opts := options.Find().SetSort(bson.M{"timestamp": 1})
+	cursor, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch trades: %v", err)
+	}
+	return decodeAll[models.Trade](ctx, cursor)
+}
+
+func (s *MongoStore) ClearTrades(ctx context.Context) error {
+	// Delete rather than drop so the index survives.
+	if _, err := s.trades.DeleteMany(ctx, bson.M{}); err != nil {
+		return fmt.Errorf("failed to clear trades: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) SaveOrder(ctx context.Context, order models.Order) error {
+	opts := options.Replace().SetUpsert(true)
+	if _, err := s.orders.ReplaceOne(ctx, bson.M{"id": order.ID}, order, opts); err != nil {
+		return fmt.Errorf("failed to save order: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) ListOrders(ctx context.Context, player string) ([]models.Order, error) {
+	filter := bson.M{}
+	if player != "" {
+		filter["player"] = player
+	}
+	return s.findOrders(ctx, filter)
+}
+
+func (s *MongoStore) ListOpenOrders(ctx context.Context) ([]models.Order, error) {
+	return s.findOrders(ctx, bson.M{"status": bson.M{"$in": []string{"open", "partial"}}})
+}
+
+func (s *MongoStore) findOrders(ctx context.Context, filter bson.M) ([]models.Order, error) {
+	opts := options.Find().SetSort(bson.M{"sequence": 1})
+	cursor, err := s.orders.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch orders: %v", err)
+	}
+	return decodeAll[models.Order](ctx, cursor)
+}
+
+func (s *MongoStore) ClearOrders(ctx context.Context) error {
+	if err := s.orders.Drop(ctx); err != nil {
+		return fmt.Errorf("failed to clear orders: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) SaveConditionalOrder(ctx context.Context, order models.ConditionalOrder) error {
+	opts := options.Replace().SetUpsert(true)
+	if _, err := s.conditional.ReplaceOne(ctx, bson.M{"id": order.ID}, order, opts); err != nil {
+		return fmt.Errorf("failed to save conditional order: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) ListConditionalOrders(ctx context.Context, player string) ([]models.ConditionalOrder, error) {
+	filter := bson.M{}
+	if player != "" {
+		filter["player"] = player
+	}
+	return s.findConditionalOrders(ctx, filter)
+}
+
+func (s *MongoStore) ListPendingConditionalOrders(ctx context.Context) ([]models.ConditionalOrder, error) {
+	return s.findConditionalOrders(ctx, bson.M{"status": "pending"})
+}
+
+func (s *MongoStore) findConditionalOrders(ctx context.Context, filter bson.M) ([]models.ConditionalOrder, error) {
+	opts := options.Find().SetSort(bson.M{"createdAt": 1})
+	cursor, err := s.conditional.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch conditional orders: %v", err)
+	}
+	return decodeAll[models.ConditionalOrder](ctx, cursor)
+}
+
+func (s *MongoStore) ClearConditionalOrders(ctx context.Context) error {
+	if err := s.conditional.Drop(ctx); err != nil {
+		return fmt.Errorf("failed to clear conditional orders: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) InsertNews(ctx context.Context, news models.News) error {
+	if _, err := s.news.InsertOne(ctx, news); err != nil {
+		return fmt.Errorf("failed to insert news: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) ListNews(ctx context.Context, limit int) ([]models.News, error) {
+	opts := options.Find().SetSort(bson.M{"time": -1}).SetLimit(int64(limit))
+	cursor, err := s.news.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch news: %v", err)
+	}
+	return decodeAll[models.News](ctx, cursor)
+}
+
+func (s *MongoStore) ClearNews(ctx context.Context) error {
+	if err := s.news.Drop(ctx); err != nil {
+		return fmt.Errorf("failed to clear news: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) InsertEquity(ctx context.Context, snapshots []models.EquitySnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(snapshots))
+	for i, snapshot := range snapshots {
+		docs[i] = snapshot
+	}
+	if _, err := s.equity.InsertMany(ctx, docs); err != nil {
+		return fmt.Errorf("failed to insert equity snapshots: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) ListEquity(ctx context.Context, player string) ([]models.EquitySnapshot, error) {
+	filter := bson.M{}
+	if player != "" {
+		filter["player"] = player
+	}
+	opts := options.Find().SetSort(bson.M{"time": 1})
+	cursor, err := s.equity.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch equity snapshots: %v", err)
+	}
+	return decodeAll[models.EquitySnapshot](ctx, cursor)
+}
+
+func (s *MongoStore) ClearEquity(ctx context.Context) error {
+	if err := s.equity.Drop(ctx); err != nil {
+		return fmt.Errorf("failed to clear equity snapshots: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) SaveRound(ctx context.Context, round models.RoundState) error {
+	opts := options.Replace().SetUpsert(true)
+	if _, err := s.rounds.ReplaceOne(ctx, bson.M{"id": round.ID}, round, opts); err != nil {
+		return fmt.Errorf("failed to save round: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) GetRound(ctx context.Context, id int) (*models.RoundState, error) {
+	var round models.RoundState
+	err := s.rounds.FindOne(ctx, bson.M{"id": id}).Decode(&round)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch round: %v", err)
+	}
+	return &round, nil
+}
+
+func (s *MongoStore) ListRounds(ctx context.Context) ([]models.RoundState, error) {
+	opts := options.Find().SetSort(bson.M{"id": -1})
+	cursor, err := s.rounds.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rounds: %v", err)
+	}
+	return decodeAll[models.RoundState](ctx, cursor)
+}
+
+func (s *MongoStore) CreateAccount(ctx context.Context, account models.Account) error {
+	_, err := s.accounts.InsertOne(ctx, account)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create account: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) GetAccount(ctx context.Context, username string) (*models.Account, error) {
+	var account models.Account
+	err := s.accounts.FindOne(ctx, bson.M{"username": username}).Decode(&account)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch account: %v", err)
+	}
+	return &account, nil
+}
+
+func (s *MongoStore) SaveAccount(ctx context.Context, account models.Account) error {
+	filter := bson.M{"username": account.Username}
+	opts := options.Replace().SetUpsert(true)
+	if _, err := s.accounts.ReplaceOne(ctx, filter, account, opts); err != nil {
+		return fmt.Errorf("failed to save account: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) RecordAudit(ctx context.Context, entry models.AuditEntry) error {
+	if _, err := s.audit.InsertOne(ctx, entry); err != nil {
+		return fmt.Errorf("failed to record audit entry: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) ListAudit(ctx context.Context, limit int) ([]models.AuditEntry, error) {
+	opts := options.Find().SetSort(bson.M{"time": -1}).SetLimit(int64(limit))
+	cursor, err := s.audit.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch audit log: %v", err)
+	}
+	return decodeAll[models.AuditEntry](ctx, cursor)
+}
+
+// ApplyBatch runs the batch in a multi-document transaction. Standalone
+// servers do not support transactions, so there it falls back to applying
+// each guarded update in turn and reverting the applied ones on failure.
+func (s *MongoStore) ApplyBatch(ctx context.Context, batch Batch) ([]models.Portfolio, error) {
+	session, err := s.client.StartSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %v", err)
+	}
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return s.applyBatch(sc, batch)
+	})
+	if transactionsUnsupported(err) {
+		return s.applyBatchWithoutTransaction(ctx, batch)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result.([]models.Portfolio), nil
+}
+
+// transactionsUnsupported reports whether err means the server cannot run
+// transactions (IllegalOperation on a standalone mongod).
+func transactionsUnsupported(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == 20
+}
+
+// changeUpdate builds the guarded filter and $inc update for a change.
+func changeUpdate(c PortfolioChange) (bson.M, bson.M) {
+	filter := bson.M{"player": c.Player}
+	inc := bson.M{}
+	guardMoney := func(field string, delta float64) {
+		if delta == 0 {
+			return
+		}
+		inc[field] = delta
+		if delta < 0 && !c.Unguarded {
+			filter[field] = bson.M{"$gte": -delta - moneyEpsilon}
+		}
+	}
+	guardShares := func(prefix string, delta map[string]int, guarded bool) {
+		for ticker, n := range delta {
+			if n == 0 {
+				continue
+			}
+			field := prefix + "." + ticker
+			inc[field] = n
+			if n < 0 && guarded && !c.Unguarded {
+				filter[field] = bson.M{"$gte": -n}
+			}
+		}
+	}
+	guardMoney("funds", c.Funds)
+	guardMoney("reservedFunds", c.ReservedFunds)
+	guardMoney("loan", c.Loan)
+	if c.Fees != 0 {
+		inc["feesPaid"] = c.Fees
+	}
+	guardShares("companies", c.Shares, !c.AllowShort)
+	guardShares("reservedShares", c.ReservedShares, true)
+	return filter, bson.M{"$inc": inc}
+}
+
+// inverse returns the change that undoes c.
+func (c PortfolioChange) inverse() PortfolioChange {
+	negate := func(m map[string]int) map[string]int {
+		out := make(map[string]int, len(m))
+		for k, v := range m {
+			out[k] = -v
+		}
+		return out
+	}
+	return PortfolioChange{
+		Player:         c.Player,
+		Funds:          -c.Funds,
+		ReservedFunds:  -c.ReservedFunds,
+		Loan:           -c.Loan,
+		Fees:           -c.Fees,
+		Shares:         negate(c.Shares),
+		ReservedShares: negate(c.ReservedShares),
+	}
+}
+
+// applyChange performs one guarded update.
+func (s *MongoStore) applyChange(ctx context.Context, c PortfolioChange) error {
+	filter, update := changeUpdate(c)
+	res, err := s.portfolios.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to update portfolio: %v", err)
+	}
+	if res.MatchedCount == 0 {
+		if _, err := s.GetPortfolio(ctx, c.Player); err != nil {
+			return err
+		}
+		return ErrInsufficient
+	}
+	return nil
+}
+
+// cleanupHoldings removes tickers whose share count reached zero. Short
+// positions reach zero from below, so any non-zero delta is checked.
+func (s *MongoStore) cleanupHoldings(ctx context.Context, c PortfolioChange) error {
+	for prefix, delta := range map[string]map[string]int{"companies": c.Shares, "reservedShares": c.ReservedShares} {
+		for ticker, n := range delta {
+			if n == 0 {
+				continue
+			}
+			field := prefix + "." + ticker
+			filter := bson.M{"player": c.Player, field: 0}
+			if _, err := s.portfolios.UpdateOne(ctx, filter, bson.M{"$unset": bson.M{field: ""}}); err != nil {
+				return fmt.Errorf("failed to clean up portfolio: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// insertLogs appends the batch's trades and transactions.
+func (s *MongoStore) insertLogs(ctx context.Context, batch Batch) error {
+	for _, entry := range []struct {
+		coll   *mongo.Collection
+		trades []models.Trade
+	}{{s.trades, batch.Trades}, {s.transactions, batch.Transactions}} {
+		if len(entry.trades) == 0 {
+			continue
+		}
+		docs := make([]interface{}, len(entry.trades))
+		for i, t := range entry.trades {
+			docs[i] = t
+		}
+		if _, err := entry.coll.InsertMany(ctx, docs); err != nil {
+			return fmt.Errorf("failed to log trades: %v", err)
+		}
+	}
+	return nil
+}
+
+// readBack returns the current portfolios in the order of batch.Changes.
+func (s *MongoStore) readBack(ctx context.Context, batch Batch) ([]models.Portfolio, error) {
+	out := make([]models.Portfolio, len(batch.Changes))
+	for i, c := range batch.Changes {
+		p, err := s.GetPortfolio(ctx, c.Player)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = *p
+	}
+	return out, nil
+}
+
+func (s *MongoStore) applyBatch(ctx context.Context, batch Batch) ([]models.Portfolio, error) {
+	for _, c := range batch.Changes {
+		if err := s.applyChange(ctx, c); err != nil {
+			return nil, err
+		}
+		if err := s.cleanupHoldings(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.insertLogs(ctx, batch); err != nil {
+		return nil, err
+	}
+	return s.readBack(ctx, batch)
+}
+
+func (s *MongoStore) applyBatchWithoutTransaction(ctx context.Context, batch Batch) ([]models.Portfolio, error) {
+	var applied []PortfolioChange
+	revert := func() {
+		for i := len(applied) - 1; i >= 0; i-- {
+			_, update := changeUpdate(applied[i].inverse())
+			s.portfolios.UpdateOne(ctx, bson.M{"player": applied[i].Player}, update)
+		}
+	}
+
+	for _, c := range batch.Changes {
+		if err := s.applyChange(ctx, c); err != nil {
+			revert()
+			return nil, err
+		}
+		applied = append(applied, c)
+	}
+	if err := s.insertLogs(ctx, batch); err != nil {
+		revert()
+		return nil, err
+	}
+	for _, c := range batch.Changes {
+		if err := s.cleanupHoldings(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	return s.readBack(ctx, batch)
+}
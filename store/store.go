@@ -0,0 +1,219 @@
+// Package store defines the persistence layer used by the game server.
+// Controllers depend only on the Store interface so the server can run
+// against MongoDB in production or entirely in memory for local work.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"midnight-trader/models"
+)
+
+var (
+	// ErrNotFound is returned when a requested record does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned when inserting a record whose key already exists.
+	ErrDuplicate = errors.New("already exists")
+	// ErrInsufficient is returned when applying a batch would leave a
+	// portfolio with a negative balance. Nothing in the batch is applied.
+	ErrInsufficient = errors.New("insufficient balance")
+)
+
+// moneyEpsilon absorbs floating point drift when guarding cash balances.
+const moneyEpsilon = 1e-6
+
+// DefaultTickInterval spaces the ticks of prices stored together when a
+// store has no TickInterval.
+const DefaultTickInterval = time.Second
+
+// tickTimes returns the times of n prices stored together at now, spaced
+// interval apart and ending at now. If that would take them back to last,
+// the time of the latest tick already stored, they are spread evenly
+// between last and now instead.
+func tickTimes(n int, last, now time.Time, interval time.Duration) []time.Time {
+	if interval <= 0 {
+		interval = DefaultTickInterval
+	}
+	step := interval
+	if first := now.Add(-time.Duration(n-1) * step); !first.After(last) {
+		step = max(now.Sub(last)/time.Duration(n), time.Nanosecond)
+	}
+	times := make([]time.Time, n)
+	for i := range times {
+		times[i] = now.Add(-time.Duration(n-1-i) * step)
+	}
+	return times
+}
+
+// PortfolioChange is a relative update to one player's portfolio. Every
+// balance it decreases is guarded: the change only applies if that balance
+// stays non-negative.
+type PortfolioChange struct {
+	Player         string
+	Funds          float64
+	ReservedFunds  float64
+	Shares         map[string]int
+	ReservedShares map[string]int
+	Loan           float64
+	// Fees is added to the portfolio's FeesPaid; the fee itself must be
+	// included in Funds or ReservedFunds.
+	Fees float64
+	// AllowShort lets Shares go negative, opening short positions. The
+	// caller is responsible for checking margin.
+	AllowShort bool
+	// Unguarded skips every guard. It is used for margin charges and forced
+	// liquidations, which go through even if they leave funds negative.
+	Unguarded bool
+}
+
+// Batch is a set of portfolio changes and log entries that must be applied
+// together or not at all.
+type Batch struct {
+	Changes []PortfolioChange
+	// Trades are appended to the trades collection.
+	Trades []models.Trade
+	// Transactions are appended to the per-player transaction log.
+	Transactions []models.Trade
+}
+
+// CompanyStore persists the tradable companies and their price history.
+type CompanyStore interface {
+	ListCompanies(ctx context.Context) ([]models.Company, error)
+	GetCompany(ctx context.Context, ticker string) (*models.Company, error)
+	// ReplaceCompanies drops every existing company and inserts the given ones.
+	ReplaceCompanies(ctx context.Context, companies []models.Company) error
+	// SetCompanyPrices overwrites a company's history and sets its stock price
+	// to the last element of prices.
+	SetCompanyPrices(ctx context.Context, ticker string, prices []float64) error
+	// AppendCompanyPrices extends a company's history and sets its stock price
+	// to the last element of prices.
+	AppendCompanyPrices(ctx context.Context, ticker string, prices []float64) error
+	// ListPriceTicks returns the prices of ticker recorded since since, oldest
+	// first. Every price a company's history gains through the methods above
+	// is recorded as a tick. Prices stored together get distinct times,
+	// spaced by the store's tick interval and ending when they were stored.
+	ListPriceTicks(ctx context.Context, ticker string, since time.Time) ([]models.PriceTick, error)
+	ClearCompanies(ctx context.Context) error
+}
+
+// PortfolioStore persists one portfolio per player.
+type PortfolioStore interface {
+	ListPortfolios(ctx context.Context) ([]models.Portfolio, error)
+	GetPortfolio(ctx context.Context, player string) (*models.Portfolio, error)
+	// CreatePortfolio inserts a new portfolio, returning ErrDuplicate if the
+	// player already has one.
+	CreatePortfolio(ctx context.Context, portfolio models.Portfolio) error
+	SavePortfolio(ctx context.Context, portfolio models.Portfolio) error
+	DeletePortfolio(ctx context.Context, player string) error
+	ClearPortfolios(ctx context.Context) error
+	// ApplyBatch atomically applies every change and log entry in the batch
+	// and returns the updated portfolios in the order of batch.Changes. It
+	// returns ErrNotFound if a portfolio is missing and ErrInsufficient if a
+	// guard fails.
+	ApplyBatch(ctx context.Context, batch Batch) ([]models.Portfolio, error)
+}
+
+// TradeStore persists executed trades and the per-player transaction log.
+type TradeStore interface {
+	InsertTrade(ctx context.Context, trade models.Trade) error
+	// ListTrades returns all trades, or only the given player's when player is non-empty.
+	ListTrades(ctx context.Context, player string) ([]models.Trade, error)
+	// ListTickerTrades returns the trades of ticker made since since, oldest
+	// first.
+	ListTickerTrades(ctx context.Context, ticker string, since time.Time) ([]models.Trade, error)
+	LogTransaction(ctx context.Context, trade models.Trade) error
+	// ListTransactions returns the transaction log, optionally filtered by player.
+	ListTransactions(ctx context.Context, player string) ([]models.Trade, error)
+	ClearTrades(ctx context.Context) error
+}
+
+// OrderStore persists order book orders so open orders survive a restart.
+type OrderStore interface {
+	// SaveOrder inserts the order or replaces the stored order with the same ID.
+	SaveOrder(ctx context.Context, order models.Order) error
+	// ListOrders returns all orders, or only the given player's when player is non-empty.
+	ListOrders(ctx context.Context, player string) ([]models.Order, error)
+	// ListOpenOrders returns every order that can still be filled.
+	ListOpenOrders(ctx context.Context) ([]models.Order, error)
+	ClearOrders(ctx context.Context) error
+}
+
+// ConditionalOrderStore persists stop-loss, take-profit, trailing stop and
+// stop-limit orders.
+type ConditionalOrderStore interface {
+	// SaveConditionalOrder inserts the order or replaces the stored order
+	// with the same ID.
+	SaveConditionalOrder(ctx context.Context, order models.ConditionalOrder) error
+	// ListConditionalOrders returns all conditional orders, or only the given
+	// player's when player is non-empty.
+	ListConditionalOrders(ctx context.Context, player string) ([]models.ConditionalOrder, error)
+	// ListPendingConditionalOrders returns every order that has not triggered
+	// or been cancelled.
+	ListPendingConditionalOrders(ctx context.Context) ([]models.ConditionalOrder, error)
+	ClearConditionalOrders(ctx context.Context) error
+}
+
+// NewsStore persists the news published during a game.
+type NewsStore interface {
+	InsertNews(ctx context.Context, news models.News) error
+	// ListNews returns up to limit news items, newest first.
+	ListNews(ctx context.Context, limit int) ([]models.News, error)
+	ClearNews(ctx context.Context) error
+}
+
+// EquityStore persists the equity snapshots of every player.
+type EquityStore interface {
+	InsertEquity(ctx context.Context, snapshots []models.EquitySnapshot) error
+	// ListEquity returns the snapshots, oldest first, optionally filtered by
+	// player.
+	ListEquity(ctx context.Context, player string) ([]models.EquitySnapshot, error)
+	ClearEquity(ctx context.Context) error
+}
+
+// RoundStore persists rounds.
+type RoundStore interface {
+	// SaveRound inserts the round or replaces the stored round with the same ID.
+	SaveRound(ctx context.Context, round models.RoundState) error
+	GetRound(ctx context.Context, id int) (*models.RoundState, error)
+	ListRounds(ctx context.Context) ([]models.RoundState, error)
+}
+
+// Store is the full persistence interface used by the server.
+type Store interface {
+	CompanyStore
+	PortfolioStore
+	TradeStore
+	OrderStore
+	ConditionalOrderStore
+	NewsStore
+	EquityStore
+	RoundStore
+}
+
+// AccountStore persists player accounts. Accounts are shared by every room,
+// so only one store holds them.
+type AccountStore interface {
+	// CreateAccount fails with ErrDuplicate if the username is taken.
+	CreateAccount(ctx context.Context, account models.Account) error
+	GetAccount(ctx context.Context, username string) (*models.Account, error)
+	// SaveAccount creates the account or replaces the one with its username.
+	SaveAccount(ctx context.Context, account models.Account) error
+}
+
+// AuditStore keeps the audit log of admin actions across every room.
+type AuditStore interface {
+	RecordAudit(ctx context.Context, entry models.AuditEntry) error
+	// ListAudit returns up to limit entries, newest first.
+	ListAudit(ctx context.Context, limit int) ([]models.AuditEntry, error)
+}
+
+var (
+	_ Store        = (*MongoStore)(nil)
+	_ Store        = (*MemoryStore)(nil)
+	_ AccountStore = (*MongoStore)(nil)
+	_ AccountStore = (*MemoryStore)(nil)
+	_ AuditStore   = (*MongoStore)(nil)
+	_ AuditStore   = (*MemoryStore)(nil)
+)
@@ -0,0 +1,338 @@
+package trading
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"midnight-trader/indicators"
+	"midnight-trader/models"
+	"midnight-trader/orderbook"
+)
+
+// validateConditional checks the fields a caller must supply on a new
+// conditional order.
+func validateConditional(o models.ConditionalOrder) error {
+	if o.Player == "" || o.Ticker == "" {
+		return fmt.Errorf("player and ticker must not be empty")
+	}
+	if o.Side != "buy" && o.Side != "sell" {
+		return fmt.Errorf("side must be 'buy' or 'sell'")
+	}
+	if o.Quantity <= 0 {
+		return fmt.Errorf("quantity must be positive")
+	}
+	switch o.Type {
+	case "stop_loss", "take_profit":
+		if o.TriggerPrice <= 0 {
+			return fmt.Errorf("trigger price must be positive")
+		}
+	case "stop_limit":
+		if o.TriggerPrice <= 0 || o.LimitPrice <= 0 {
+			return fmt.Errorf("trigger and limit price must be positive")
+		}
+	case "trailing_stop":
+		if (o.TrailPercent > 0) == (o.TrailAmount > 0) {
+			return fmt.Errorf("trailing stop needs either a trail percent or a trail amount")
+		}
+		if o.TrailPercent >= 100 {
+			return fmt.Errorf("trail percent must be below 100")
+		}
+	default:
+		return fmt.Errorf("type must be 'stop_loss', 'take_profit', 'trailing_stop' or 'stop_limit'")
+	}
+	return nil
+}
+
+// triggered reports whether price sets o off. Stops protect against the
+// price moving against the player: a sell stop fires when the price falls to
+// the trigger, a buy stop (covering a short) when it rises to it. Take-profit
+// orders fire on the opposite move.
+func triggered(o *models.ConditionalOrder, price float64) bool {
+	falling := o.Side == "sell"
+	if o.Type == "take_profit" {
+		falling = !falling
+	}
+	if falling {
+		return price <= o.TriggerPrice
+	}
+	return price >= o.TriggerPrice
+}
+
+// trail moves a trailing stop's trigger after the best price seen so far. It
+// reports whether the trigger moved.
+func trail(o *models.ConditionalOrder, price float64) bool {
+	if o.Type != "trailing_stop" {
+		return false
+	}
+	if o.BestPrice != 0 && (o.Side == "sell" && price <= o.BestPrice || o.Side == "buy" && price >= o.BestPrice) {
+		return false
+	}
+	o.BestPrice = price
+
+	offset := o.TrailAmount
+	if o.TrailPercent > 0 {
+		offset = price * o.TrailPercent / 100
+	}
+	if o.Side == "sell" {
+		o.TriggerPrice = price - offset
+	} else {
+		o.TriggerPrice = price + offset
+	}
+	return true
+}
+
+// RestoreConditionalOrders loads every pending conditional order so it is
+// evaluated on the next price change.
+func (s *Service) RestoreConditionalOrders(ctx context.Context) error {
+	orders, err := s.Store.ListPendingConditionalOrders(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.conditionalMu.Lock()
+	defer s.conditionalMu.Unlock()
+	for _, o := range orders {
+		s.conditional[o.ID] = &o
+	}
+	log.Printf("Restored %d conditional orders", len(orders))
+	return nil
+}
+
+// PlaceConditionalOrder stores a new conditional order. Nothing is reserved
+// for it: when it triggers it trades through the normal trade path and fails
+// if the player can't cover it then.
+func (s *Service) PlaceConditionalOrder(ctx context.Context, order models.ConditionalOrder) (models.ConditionalOrder, error) {
+	if err := validateConditional(order); err != nil {
+		return order, err
+	}
+	price, err := s.Price(ctx, order.Ticker)
+	if err != nil {
+		return order, err
+	}
+
+	now := time.Now()
+	order.ID = models.NewID()
+	order.Status = "pending"
+	order.BestPrice = 0
+	order.CreatedAt = now
+	order.UpdatedAt = now
+	trail(&order, price)
+	if err := s.Store.SaveConditionalOrder(ctx, order); err != nil {
+		return order, err
+	}
+
+	s.conditionalMu.Lock()
+	stored := order
+	s.conditional[order.ID] = &stored
+	s.conditionalMu.Unlock()
+
+	s.Hub.Broadcast <- models.WSMessage{
+		Event: "conditional_order_placed",
+		Data:  order,
+	}
+	// The trigger may already be crossed at the current price.
+	s.PublishPrice(order.Ticker, price)
+	return order, nil
+}
+
+// CancelConditionalOrder cancels one of a player's pending conditional orders.
+func (s *Service) CancelConditionalOrder(ctx context.Context, player, id string) (models.ConditionalOrder, error) {
+	s.conditionalMu.Lock()
+	o, ok := s.conditional[id]
+	if !ok {
+		s.conditionalMu.Unlock()
+		return models.ConditionalOrder{}, orderbook.ErrOrderNotFound
+	}
+	if o.Player != player {
+		s.conditionalMu.Unlock()
+		return models.ConditionalOrder{}, orderbook.ErrNotOwner
+	}
+	delete(s.conditional, id)
+	s.conditionalMu.Unlock()
+
+	order := *o
+	order.Status = "cancelled"
+	order.UpdatedAt = time.Now()
+	if err := s.Store.SaveConditionalOrder(ctx, order); err != nil {
+		return order, err
+	}
+
+	s.Hub.Broadcast <- models.WSMessage{
+		Event: "conditional_order_cancelled",
+		Data:  order,
+	}
+	return order, nil
+}
+
+// cancelConditionalOrders cancels every pending conditional order of player.
+func (s *Service) cancelConditionalOrders(ctx context.Context, player string) error {
+	s.conditionalMu.Lock()
+	var ids []string
+	for id, o := range s.conditional {
+		if o.Player == player {
+			ids = append(ids, id)
+		}
+	}
+	s.conditionalMu.Unlock()
+
+	for _, id := range ids {
+		_, err := s.CancelConditionalOrder(ctx, player, id)
+		if err != nil && err != orderbook.ErrOrderNotFound {
+			return fmt.Errorf("failed to cancel conditional order %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// PublishPrice announces a new price for ticker with a "stock_update" event
+// and queues the conditional orders on ticker for evaluation. It never blocks
+// on the evaluation, so it is safe to call while holding orderMu.
+func (s *Service) PublishPrice(ticker string, price float64) {
+	s.Hub.Broadcast <- models.WSMessage{
+		Event: "stock_update",
+		Data: map[string]interface{}{
+			"ticker": ticker,
+			"price":  price,
+		},
+	}
+
+	s.pricesMu.Lock()
+	s.prices[ticker] = price
+	s.pricesMu.Unlock()
+	select {
+	case s.pricesChanged <- struct{}{}:
+	default:
+	}
+}
+
+// watchPrices evaluates conditional orders against published prices, after
+// announcing the new indicators if Indicators is set. Prices published while
+// an evaluation runs are coalesced, keeping only the latest per ticker.
+func (s *Service) watchPrices() {
+	for range s.pricesChanged {
+		s.pricesMu.Lock()
+		prices := s.prices
+		s.prices = make(map[string]float64)
+		s.pricesMu.Unlock()
+
+		for ticker, price := range prices {
+			if s.Indicators {
+				s.publishIndicators(ticker)
+			}
+			s.evaluateConditional(ticker, price)
+		}
+	}
+}
+
+// publishIndicators announces the latest indicators over a company's price
+// ticks and trade volume with a "stock_indicators" event, computed as
+// GET /api/companies/:ticker/indicators does with its defaults. It reads
+// the store, so it runs from watchPrices rather than on every PublishPrice.
+func (s *Service) publishIndicators(ticker string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	candles, err := s.CompanyCandles(ctx, ticker, 0)
+	cancel()
+	if err != nil {
+		log.Printf("Failed to load %s for its indicators: %v", ticker, err)
+		return
+	}
+	if len(candles) == 0 {
+		return
+	}
+	set := indicators.FromCandles(candles, indicators.DefaultPeriod, indicators.DefaultRSIPeriod)
+	s.Hub.Broadcast <- models.WSMessage{
+		Event: "stock_indicators",
+		Data: map[string]interface{}{
+			"ticker":     ticker,
+			"price":      candles[len(candles)-1].Close,
+			"indicators": set.Latest(),
+		},
+	}
+}
+
+// evaluateConditional moves the trailing stops on ticker and executes every
+// conditional order that price triggers, oldest first.
+func (s *Service) evaluateConditional(ticker string, price float64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var fired, trailed []models.ConditionalOrder
+	s.conditionalMu.Lock()
+	for id, o := range s.conditional {
+		if o.Ticker != ticker {
+			continue
+		}
+		if trail(o, price) {
+			o.UpdatedAt = time.Now()
+			trailed = append(trailed, *o)
+		}
+		if triggered(o, price) {
+			delete(s.conditional, id)
+			fired = append(fired, *o)
+		}
+	}
+	s.conditionalMu.Unlock()
+
+	for _, o := range trailed {
+		if err := s.Store.SaveConditionalOrder(ctx, o); err != nil {
+			log.Printf("Failed to save conditional order %s: %v", o.ID, err)
+		}
+	}
+
+	sort.Slice(fired, func(i, j int) bool { return fired[i].CreatedAt.Before(fired[j].CreatedAt) })
+	for _, o := range fired {
+		s.executeConditional(ctx, o, price)
+	}
+}
+
+// executeConditional sends a triggered order down the normal trade path and
+// emits "order_triggered" with the outcome.
+func (s *Service) executeConditional(ctx context.Context, o models.ConditionalOrder, price float64) {
+	data := map[string]interface{}{
+		"price": price,
+	}
+
+	var err error
+	if o.Type == "stop_limit" {
+		var placed models.Order
+		placed, _, err = s.PlaceOrder(ctx, models.Order{
+			Player:   o.Player,
+			Ticker:   o.Ticker,
+			Side:     o.Side,
+			Type:     "limit",
+			Price:    o.LimitPrice,
+			Quantity: o.Quantity,
+		})
+		if err == nil {
+			o.OrderID = placed.ID
+			data["order"] = placed
+		}
+	} else {
+		// A protective exit sells what is left of the position rather than
+		// opening a short when the player has sold shares since.
+		var trade models.Trade
+		trade, _, err = s.trade(ctx, o.Player, o.Ticker, o.Side, o.Quantity, true)
+		if err == nil {
+			data["trade"] = trade
+		}
+	}
+
+	o.Status = "triggered"
+	if err != nil {
+		o.Status = "failed"
+		o.Error = err.Error()
+	}
+	o.UpdatedAt = time.Now()
+	if err := s.Store.SaveConditionalOrder(ctx, o); err != nil {
+		log.Printf("Failed to save conditional order %s: %v", o.ID, err)
+	}
+
+	data["conditional_order"] = o
+	s.Hub.Broadcast <- models.WSMessage{
+		Event: "order_triggered",
+		Data:  data,
+	}
+}
@@ -0,0 +1,117 @@
+package trading
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"midnight-trader/indicators"
+	"midnight-trader/models"
+)
+
+// waitConditional waits for the watcher to settle player's only conditional
+// order and returns it.
+func waitConditional(t *testing.T, s *Service, player string) models.ConditionalOrder {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		orders, err := s.Store.ListConditionalOrders(context.Background(), player)
+		if err != nil {
+			t.Fatalf("ListConditionalOrders: %v", err)
+		}
+		if len(orders) == 1 && orders[0].Status != "pending" {
+			return orders[0]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("conditional order never triggered")
+	return models.ConditionalOrder{}
+}
+
+// dropPrice moves the price of NMBS to price and publishes it.
+func dropPrice(t *testing.T, s *Service, price float64) {
+	t.Helper()
+	if err := s.Store.AppendCompanyPrices(context.Background(), "NMBS", []float64{price}); err != nil {
+		t.Fatalf("AppendCompanyPrices: %v", err)
+	}
+	s.PublishPrice("NMBS", price)
+}
+
+func TestStopLossNeverOpensShort(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		sold   int
+		status string
+	}{
+		// 4 of the 10 shares the stop covers are left to sell.
+		{"partly sold", 6, "triggered"},
+		// Nothing is left, so the stop fails instead of selling short.
+		{"sold out", 10, "failed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newTestService(t)
+			if _, _, err := s.Trade(ctx, "alice", "NMBS", "buy", 10); err != nil {
+				t.Fatalf("Trade: %v", err)
+			}
+			if _, err := s.PlaceConditionalOrder(ctx, models.ConditionalOrder{
+				Player: "alice", Ticker: "NMBS", Side: "sell", Type: "stop_loss", TriggerPrice: 45, Quantity: 10,
+			}); err != nil {
+				t.Fatalf("PlaceConditionalOrder: %v", err)
+			}
+			if _, _, err := s.Trade(ctx, "alice", "NMBS", "sell", tc.sold); err != nil {
+				t.Fatalf("Trade: %v", err)
+			}
+
+			dropPrice(t, s, 40)
+			o := waitConditional(t, s, "alice")
+			if o.Status != tc.status {
+				t.Errorf("conditional order %s (%s), want %s", o.Status, o.Error, tc.status)
+			}
+			if o.Status == "failed" && o.Error != ErrNoPosition.Error() {
+				t.Errorf("conditional order failed with %q, want %q", o.Error, ErrNoPosition)
+			}
+			if shares := mustPortfolio(t, s, "alice").Companies["NMBS"]; shares != 0 {
+				t.Errorf("alice holds %d shares, want none", shares)
+			}
+		})
+	}
+}
+
+func TestIndicatorsMatchCandles(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	s.Indicators = true
+	client := &models.Client{Send: make(chan models.WSMessage, 16)}
+	s.Hub.Register <- client
+
+	if _, _, err := s.Trade(ctx, "alice", "NMBS", "buy", 10); err != nil {
+		t.Fatalf("Trade: %v", err)
+	}
+	dropPrice(t, s, 40)
+
+	var data map[string]interface{}
+	timeout := time.After(2 * time.Second)
+	for data == nil || data["price"] != 40.0 {
+		select {
+		case msg := <-client.Send:
+			if msg.Event == "stock_indicators" {
+				data = msg.Data.(map[string]interface{})
+			}
+		case <-timeout:
+			t.Fatal("no indicators for the new price")
+		}
+	}
+
+	// The push agrees with the indicators endpoint, volume included.
+	candles, err := s.CompanyCandles(ctx, "NMBS", 0)
+	if err != nil {
+		t.Fatalf("CompanyCandles: %v", err)
+	}
+	want := indicators.FromCandles(candles, indicators.DefaultPeriod, indicators.DefaultRSIPeriod).Latest()
+	got, _ := json.Marshal(data["indicators"])
+	if expected, _ := json.Marshal(want); string(got) != string(expected) || want.VWAP == nil {
+		t.Errorf("pushed %s, want %s", got, expected)
+	}
+}
@@ -0,0 +1,210 @@
+package trading
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"midnight-trader/models"
+)
+
+// Cost basis methods: FIFO closes the oldest shares first, average cost
+// closes shares at the average price of the whole position.
+const (
+	CostFIFO    = "fifo"
+	CostAverage = "average"
+)
+
+var ErrUnknownCostMethod = errors.New("cost basis method must be fifo or average")
+
+// Position is a player's holding of one company with its cost basis. Short
+// positions have negative Shares.
+type Position struct {
+	Ticker string `json:"ticker"`
+	Shares int    `json:"shares"`
+	// CostBasis is what the open shares cost, or for a short position what
+	// selling them brought in, fees included.
+	CostBasis     float64 `json:"costBasis"`
+	AverageCost   float64 `json:"averageCost"`
+	MarketPrice   float64 `json:"marketPrice"`
+	MarketValue   float64 `json:"marketValue"`
+	RealizedPnL   float64 `json:"realizedPnl"`
+	UnrealizedPnL float64 `json:"unrealizedPnl"`
+}
+
+// Realization is the profit or loss locked in by a trade that closed shares.
+type Realization struct {
+	Ticker    string    `json:"ticker"`
+	Type      string    `json:"type"`
+	Shares    int       `json:"shares"` // shares closed by the trade
+	Price     float64   `json:"price"`
+	CostBasis float64   `json:"costBasis"` // cost basis of the closed shares
+	PnL       float64   `json:"pnl"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Performance is a portfolio's profit and loss by position.
+type Performance struct {
+	Method        string        `json:"method"`
+	Positions     []Position    `json:"positions"`
+	Realizations  []Realization `json:"realizations"`
+	RealizedPnL   float64       `json:"realizedPnl"`
+	UnrealizedPnL float64       `json:"unrealizedPnl"`
+	TotalPnL      float64       `json:"totalPnl"`
+}
+
+// lot is a block of shares opened at one price, fees included. Short lots
+// have negative shares.
+type lot struct {
+	shares int
+	price  float64
+}
+
+// CostBasis replays trades, oldest first, into positions using method and
+// values them at prices. Fees count towards the cost of the shares a trade
+// opens and against the proceeds of the shares it closes.
+func CostBasis(trades []models.Trade, method string, prices map[string]float64) (Performance, error) {
+	if method != CostFIFO && method != CostAverage {
+		return Performance{}, ErrUnknownCostMethod
+	}
+	trades = append([]models.Trade(nil), trades...)
+	sort.SliceStable(trades, func(i, j int) bool {
+		return trades[i].Timestamp.Before(trades[j].Timestamp)
+	})
+
+	perf := Performance{Method: method, Positions: []Position{}, Realizations: []Realization{}}
+	lots := make(map[string][]lot)
+	realized := make(map[string]float64)
+	for _, t := range trades {
+		if t.Amount <= 0 {
+			continue
+		}
+		// Every share of the trade goes for price, moved by its share of
+		// the fee against the player.
+		shares, price := t.Amount, t.Price+t.Fee/float64(t.Amount)
+		if t.Type == "sell" {
+			shares, price = -t.Amount, t.Price-t.Fee/float64(t.Amount)
+		}
+
+		open := lots[t.Ticker]
+		closed, basis, pnl := 0, 0.0, 0.0
+		for shares != 0 && len(open) > 0 && sign(open[0].shares) != sign(shares) {
+			n := min(abs(shares), abs(open[0].shares))
+			direction := sign(open[0].shares)
+			closed += n
+			basis += open[0].price * float64(n)
+			pnl += float64(direction) * (price - open[0].price) * float64(n)
+			open[0].shares -= direction * n
+			shares += direction * n
+			if open[0].shares == 0 {
+				open = open[1:]
+			}
+		}
+		if shares != 0 {
+			open = append(open, lot{shares: shares, price: price})
+			if method == CostAverage {
+				open = []lot{average(open)}
+			}
+		}
+		lots[t.Ticker] = open
+
+		if closed > 0 {
+			realized[t.Ticker] += pnl
+			perf.RealizedPnL += pnl
+			perf.Realizations = append(perf.Realizations, Realization{
+				Ticker:    t.Ticker,
+				Type:      t.Type,
+				Shares:    closed,
+				Price:     t.Price,
+				CostBasis: roundCents(basis),
+				PnL:       roundCents(pnl),
+				Timestamp: t.Timestamp,
+			})
+		}
+	}
+
+	tickers := make([]string, 0, len(lots))
+	for ticker := range lots {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+	for _, ticker := range tickers {
+		pos := Position{
+			Ticker:      ticker,
+			MarketPrice: prices[ticker],
+			RealizedPnL: roundCents(realized[ticker]),
+		}
+		for _, l := range lots[ticker] {
+			pos.Shares += l.shares
+			pos.CostBasis += l.price * float64(abs(l.shares))
+		}
+		if pos.Shares != 0 {
+			pos.AverageCost = roundCents(pos.CostBasis / float64(abs(pos.Shares)))
+			pos.MarketValue = float64(pos.Shares) * pos.MarketPrice
+			pos.UnrealizedPnL = pos.MarketValue - float64(sign(pos.Shares))*pos.CostBasis
+		}
+		perf.UnrealizedPnL += pos.UnrealizedPnL
+		pos.CostBasis = roundCents(pos.CostBasis)
+		pos.MarketValue = roundCents(pos.MarketValue)
+		pos.UnrealizedPnL = roundCents(pos.UnrealizedPnL)
+		perf.Positions = append(perf.Positions, pos)
+	}
+
+	perf.RealizedPnL = roundCents(perf.RealizedPnL)
+	perf.UnrealizedPnL = roundCents(perf.UnrealizedPnL)
+	perf.TotalPnL = roundCents(perf.RealizedPnL + perf.UnrealizedPnL)
+	return perf, nil
+}
+
+// average merges lots on the same side into one at their average price.
+func average(lots []lot) lot {
+	merged := lot{}
+	cost := 0.0
+	for _, l := range lots {
+		merged.shares += l.shares
+		cost += l.price * float64(l.shares)
+	}
+	merged.price = cost / float64(merged.shares)
+	return merged
+}
+
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Performance returns the profit and loss of p by position, replaying the
+// player's transactions since the portfolio was last reset.
+func (s *Service) Performance(ctx context.Context, p models.Portfolio, method string) (Performance, error) {
+	if method != CostFIFO && method != CostAverage {
+		return Performance{}, ErrUnknownCostMethod
+	}
+	transactions, err := s.Store.ListTransactions(ctx, p.Player)
+	if err != nil {
+		return Performance{}, err
+	}
+	trades := transactions[:0:0]
+	for _, t := range transactions {
+		if !t.Timestamp.Before(p.Since) {
+			trades = append(trades, t)
+		}
+	}
+	prices, err := s.currentPrices(ctx)
+	if err != nil {
+		return Performance{}, err
+	}
+	return CostBasis(trades, method, prices)
+}
@@ -0,0 +1,109 @@
+package trading
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"midnight-trader/models"
+)
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// costBasisTrades buys into a position at two prices, sells most of it and
+// then sells past it into a short position.
+func costBasisTrades() []models.Trade {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	trades := []models.Trade{
+		{Type: "buy", Amount: 10, Price: 10},
+		{Type: "buy", Amount: 10, Price: 20},
+		{Type: "sell", Amount: 15, Price: 30},
+		{Type: "sell", Amount: 10, Price: 25, Fee: 1},
+	}
+	for i := range trades {
+		trades[i].Ticker = "NMBS"
+		trades[i].Timestamp = start.Add(time.Duration(i) * time.Minute)
+	}
+	// CostBasis must replay in time order whatever order it gets.
+	trades[0], trades[3] = trades[3], trades[0]
+	return trades
+}
+
+func TestCostBasis(t *testing.T) {
+	prices := map[string]float64{"NMBS": 22}
+	for _, tc := range []struct {
+		method       string
+		realizations []float64
+	}{
+		// FIFO sells the 10 shares at 10 and 5 of those at 20 first, then
+		// the last 5 at 20 for 25 less 0.1 of fee each.
+		{CostFIFO, []float64{10*20 + 5*10, 5 * (24.9 - 20)}},
+		// Average cost closes every share at 15.
+		{CostAverage, []float64{15 * 15, 5 * (24.9 - 15)}},
+	} {
+		t.Run(tc.method, func(t *testing.T) {
+			perf, err := CostBasis(costBasisTrades(), tc.method, prices)
+			if err != nil {
+				t.Fatalf("CostBasis: %v", err)
+			}
+
+			if len(perf.Realizations) != len(tc.realizations) {
+				t.Fatalf("got %d realizations, want %d", len(perf.Realizations), len(tc.realizations))
+			}
+			for i, want := range tc.realizations {
+				if got := perf.Realizations[i].PnL; !approx(got, want) {
+					t.Errorf("realization %d = %v, want %v", i, got, want)
+				}
+			}
+			if got := perf.Realizations[1].Shares; got != 5 {
+				t.Errorf("the second sale closed %d shares, want 5", got)
+			}
+
+			// Either way 5 shares are left short at 24.9.
+			if len(perf.Positions) != 1 {
+				t.Fatalf("got positions %+v, want one", perf.Positions)
+			}
+			pos := perf.Positions[0]
+			if pos.Shares != -5 || !approx(pos.CostBasis, 124.5) || !approx(pos.AverageCost, 24.9) {
+				t.Errorf("position = %+v, want -5 shares at 24.9", pos)
+			}
+			if !approx(pos.MarketValue, -110) || !approx(pos.UnrealizedPnL, 14.5) {
+				t.Errorf("position = %+v, want worth -110 with 14.5 unrealized", pos)
+			}
+
+			if !approx(perf.RealizedPnL, 274.5) || !approx(perf.UnrealizedPnL, 14.5) || !approx(perf.TotalPnL, 289) {
+				t.Errorf("P&L = %v realized, %v unrealized, %v total, want 274.5, 14.5, 289",
+					perf.RealizedPnL, perf.UnrealizedPnL, perf.TotalPnL)
+			}
+		})
+	}
+}
+
+func TestCostBasisCoverShort(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	trades := []models.Trade{
+		{Ticker: "NMBS", Type: "sell", Amount: 10, Price: 50, Timestamp: start},
+		{Ticker: "NMBS", Type: "buy", Amount: 10, Price: 40, Fee: 2, Timestamp: start.Add(time.Minute)},
+	}
+	for _, method := range []string{CostFIFO, CostAverage} {
+		perf, err := CostBasis(trades, method, map[string]float64{"NMBS": 45})
+		if err != nil {
+			t.Fatalf("CostBasis(%s): %v", method, err)
+		}
+		// A closed position stays listed for its realized P&L.
+		if len(perf.Positions) != 1 || perf.Positions[0].Shares != 0 || !approx(perf.Positions[0].RealizedPnL, 98) {
+			t.Errorf("%s: got positions %+v, want a closed one with 98 realized", method, perf.Positions)
+		}
+		if !approx(perf.RealizedPnL, 98) || perf.UnrealizedPnL != 0 {
+			t.Errorf("%s: got %v realized and %v unrealized, want 98 and 0", method, perf.RealizedPnL, perf.UnrealizedPnL)
+		}
+	}
+}
+
+func TestCostBasisUnknownMethod(t *testing.T) {
+	if _, err := CostBasis(nil, "lifo", nil); err != ErrUnknownCostMethod {
+		t.Errorf("got %v, want ErrUnknownCostMethod", err)
+	}
+}
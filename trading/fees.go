@@ -0,0 +1,24 @@
+package trading
+
+import "math"
+
+// FeeConfig is the commission charged on every trade: a flat amount plus a
+// percentage of the trade's value, but never less than Minimum. The zero
+// value charges nothing.
+type FeeConfig struct {
+	Flat    float64 `json:"flat"`
+	Percent float64 `json:"percent"` // of the trade value, e.g. 0.1 for 0.1%
+	Minimum float64 `json:"minimum"`
+}
+
+// DefaultFees charges 0.1% of every trade with a minimum of 1.
+var DefaultFees = FeeConfig{Percent: 0.1, Minimum: 1}
+
+// Fee returns the commission on a trade worth value, rounded to cents.
+func (f FeeConfig) Fee(value float64) float64 {
+	fee := f.Flat + math.Abs(value)*f.Percent/100
+	if fee < f.Minimum {
+		fee = f.Minimum
+	}
+	return math.Round(fee*100) / 100
+}
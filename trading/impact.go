@@ -0,0 +1,53 @@
+package trading
+
+import (
+	"math"
+
+	"midnight-trader/models"
+)
+
+// ImpactConfig is the liquidity model for trades at market. Trading value V
+// of a company moves its price by Coefficient·√(V/L), where L is the
+// company's Liquidity or, if unset, the room's. The order fills along the
+// way, at an average price two thirds of the way to the final one. The zero
+// value disables price impact.
+type ImpactConfig struct {
+	// Coefficient is the price move, as a fraction of the price, caused by
+	// trading the liquidity in one go.
+	Coefficient float64 `json:"coefficient"`
+	// Liquidity is the traded value that moves a price by Coefficient, for
+	// companies that don't set their own.
+	Liquidity float64 `json:"liquidity"`
+}
+
+// DefaultImpact moves a price by about 3% when a player puts their whole
+// starting funds into one company.
+var DefaultImpact = ImpactConfig{Coefficient: 0.1, Liquidity: 100000}
+
+// Fill returns the average execution price of trading quantity shares of
+// company on side, and the price the trade leaves the company at.
+func (c ImpactConfig) Fill(company models.Company, side string, quantity int) (avg, after float64) {
+	price := company.StockPrice
+	liquidity := company.Liquidity
+	if liquidity <= 0 {
+		liquidity = c.Liquidity
+	}
+	if c.Coefficient <= 0 || liquidity <= 0 {
+		return price, price
+	}
+
+	move := c.Coefficient * math.Sqrt(price*float64(quantity)/liquidity)
+	if side == "sell" {
+		move = -move
+	}
+	avg = math.Max(roundCents(price*(1+move*2/3)), minPrice)
+	after = math.Max(roundCents(price*(1+move)), minPrice)
+	return avg, after
+}
+
+// minPrice keeps prices moved by trades strictly positive.
+const minPrice = 0.01
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
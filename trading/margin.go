@@ -0,0 +1,298 @@
+package trading
+
+import (
+	"context"
+	"log"
+	"maps"
+	"time"
+
+	"midnight-trader/models"
+	"midnight-trader/store"
+)
+
+// MarginConfig sets the requirements for trading on margin: short positions
+// and, with Leverage, long positions bought with borrowed cash. Requirements
+// are ratios of a player's equity to their exposure (see MarginStatus).
+type MarginConfig struct {
+	// InitialMargin is the ratio a trade on margin must leave the player at.
+	// It caps leverage at 1/InitialMargin.
+	InitialMargin float64
+	// MarginCall is the ratio below which the player is warned.
+	MarginCall float64
+	// Maintenance is the ratio below which positions are liquidated.
+	Maintenance float64
+	// BorrowRate is the fee charged every price tick, as a fraction of the
+	// market value of the short positions.
+	BorrowRate float64
+	// Leverage lets buys borrow the cash the player lacks.
+	Leverage bool
+	// LoanRate is the interest added to the loan every price tick, as a
+	// fraction of the loan.
+	LoanRate float64
+}
+
+// DefaultMargin mirrors the usual 50% initial and 25% maintenance margin.
+var DefaultMargin = MarginConfig{
+	InitialMargin: 0.5,
+	MarginCall:    0.35,
+	Maintenance:   0.25,
+	BorrowRate:    0.0005,
+	Leverage:      true,
+	LoanRate:      0.0002,
+}
+
+// MarginStatus describes a portfolio's exposure at current prices.
+type MarginStatus struct {
+	// Equity is the portfolio's net value.
+	Equity     float64 `json:"equity"`
+	Loan       float64 `json:"loan"`
+	LongValue  float64 `json:"longValue"`
+	ShortValue float64 `json:"shortValue"`
+	// Exposure is what the margin requirements apply to: the short
+	// positions, plus the long positions while there is a loan.
+	Exposure float64 `json:"exposure"`
+	// Ratio is Equity divided by Exposure, or 0 without exposure.
+	Ratio float64 `json:"ratio"`
+}
+
+// currentPrices returns the stock price of every company by ticker.
+func (s *Service) currentPrices(ctx context.Context) (map[string]float64, error) {
+	companies, err := s.Store.ListCompanies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	prices := make(map[string]float64, len(companies))
+	for _, c := range companies {
+		prices[c.Ticker] = c.StockPrice
+	}
+	return prices, nil
+}
+
+// marginStatus values p at prices. Equity counts everything the player owns,
+// including funds and shares held by open orders, minus the short positions
+// and the loan.
+func marginStatus(p models.Portfolio, prices map[string]float64) MarginStatus {
+	status := MarginStatus{Loan: p.Loan}
+	status.Equity = p.Funds + p.ReservedFunds - p.Loan
+	for ticker, shares := range p.Companies {
+		value := float64(shares) * prices[ticker]
+		status.Equity += value
+		if shares < 0 {
+			status.ShortValue -= value
+		} else {
+			status.LongValue += value
+		}
+	}
+	for ticker, shares := range p.ReservedShares {
+		value := float64(shares) * prices[ticker]
+		status.Equity += value
+		status.LongValue += value
+	}
+
+	status.Exposure = status.ShortValue
+	if p.Loan > 0 {
+		status.Exposure += status.LongValue
+	}
+	if status.Exposure > 0 {
+		status.Ratio = status.Equity / status.Exposure
+	}
+	return status
+}
+
+// onMargin reports whether p has a short position or a loan.
+func onMargin(p models.Portfolio) bool {
+	if p.Loan > 0 {
+		return true
+	}
+	for _, shares := range p.Companies {
+		if shares < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// MarginStatus returns the margin status of p at current prices.
+func (s *Service) MarginStatus(ctx context.Context, p models.Portfolio) (MarginStatus, error) {
+	prices, err := s.currentPrices(ctx)
+	if err != nil {
+		return MarginStatus{}, err
+	}
+	return marginStatus(p, prices), nil
+}
+
+// checkInitialMargin fails with ErrInsufficientMargin unless p would still
+// meet the initial margin requirement after change.
+func (s *Service) checkInitialMargin(ctx context.Context, p models.Portfolio, change store.PortfolioChange) error {
+	prices, err := s.currentPrices(ctx)
+	if err != nil {
+		return err
+	}
+
+	after := p
+	after.Funds += change.Funds
+	after.Loan += change.Loan
+	after.Companies = maps.Clone(p.Companies)
+	if after.Companies == nil {
+		after.Companies = make(map[string]int)
+	}
+	for ticker, n := range change.Shares {
+		after.Companies[ticker] += n
+	}
+
+	status := marginStatus(after, prices)
+	if status.Equity < s.Margin.InitialMargin*status.Exposure {
+		return ErrInsufficientMargin
+	}
+	return nil
+}
+
+// MarginTick charges borrow fees on short positions and interest on loans,
+// then enforces the maintenance requirement: players below MarginCall get a
+// "margin_call" warning, players below Maintenance have their positions
+// liquidated at market. It runs once per price tick.
+func (s *Service) MarginTick(ctx context.Context) {
+	portfolios, err := s.Store.ListPortfolios(ctx)
+	if err != nil {
+		log.Println("MarginTick: failed to fetch portfolios:", err)
+		return
+	}
+	prices, err := s.currentPrices(ctx)
+	if err != nil {
+		log.Println("MarginTick: failed to fetch prices:", err)
+		return
+	}
+
+	changed := false
+	for _, p := range portfolios {
+		if !onMargin(p) {
+			continue
+		}
+		if err := s.settleMargin(ctx, p, prices); err != nil {
+			log.Printf("MarginTick: failed to settle margin for %s: %v", p.Player, err)
+			continue
+		}
+		changed = true
+	}
+	if changed {
+		s.BroadcastPortfolios(ctx)
+	}
+}
+
+// settleMargin charges one tick of borrow fees and interest to p and then
+// checks it against the maintenance requirement.
+func (s *Service) settleMargin(ctx context.Context, p models.Portfolio, prices map[string]float64) error {
+	s.marginMu.Lock()
+	defer s.marginMu.Unlock()
+
+	status := marginStatus(p, prices)
+	fee := status.ShortValue * s.Margin.BorrowRate
+	interest := p.Loan * s.Margin.LoanRate
+	if fee > 0 || interest > 0 {
+		updated, err := s.Store.ApplyBatch(ctx, store.Batch{
+			Changes: []store.PortfolioChange{{Player: p.Player, Funds: -fee, Loan: interest, Unguarded: true}},
+		})
+		if err != nil {
+			return err
+		}
+		p = updated[0]
+		status = marginStatus(p, prices)
+	}
+
+	switch {
+	case status.Exposure > 0 && status.Ratio < s.Margin.Maintenance:
+		return s.liquidate(ctx, p, prices, status)
+	case status.Exposure > 0 && status.Ratio < s.Margin.MarginCall:
+		s.Hub.SendTo(p.Player, models.WSMessage{
+			Event: "margin_call",
+			Data:  s.marginEventData(p.Player, status),
+		})
+	}
+	s.broadcastPortfolio(p)
+	return nil
+}
+
+func (s *Service) marginEventData(player string, status MarginStatus) map[string]interface{} {
+	return map[string]interface{}{
+		"round_id":     s.RoundID(),
+		"player":       player,
+		"equity":       status.Equity,
+		"loan":         status.Loan,
+		"short_value":  status.ShortValue,
+		"exposure":     status.Exposure,
+		"margin_ratio": status.Ratio,
+		"maintenance":  s.Margin.Maintenance,
+	}
+}
+
+// liquidate cancels every order of p, releasing what they held, then
+// closes every short position at market and, if p has a loan, sells every
+// long position and repays the loan from the proceeds. The liquidation goes
+// through even if it leaves the player's funds negative.
+func (s *Service) liquidate(ctx context.Context, p models.Portfolio, prices map[string]float64, status MarginStatus) error {
+	// Released shares would otherwise escape the sale, and a resting order
+	// could reopen a position right after it was closed.
+	if err := s.CancelAllOrders(ctx, p.Player); err != nil {
+		return err
+	}
+	current, err := s.Store.GetPortfolio(ctx, p.Player)
+	if err != nil {
+		return err
+	}
+	p = *current
+
+	change := store.PortfolioChange{Player: p.Player, Shares: make(map[string]int), Unguarded: true}
+	var trades []models.Trade
+	for ticker, shares := range p.Companies {
+		if shares > 0 && p.Loan <= 0 {
+			continue
+		}
+		company, err := s.company(ctx, ticker)
+		if err != nil {
+			return err
+		}
+		trade := models.Trade{
+			Player:      p.Player,
+			Company:     company.Name,
+			Ticker:      ticker,
+			Type:        "buy",
+			Amount:      -shares,
+			Price:       prices[ticker],
+			Timestamp:   time.Now(),
+			Liquidation: true,
+		}
+		if shares > 0 {
+			trade.Type = "sell"
+			trade.Amount = shares
+		}
+		trade.Fee = s.Fees.Fee(trade.Price * float64(trade.Amount))
+		change.Funds += float64(shares)*trade.Price - trade.Fee
+		change.Fees += trade.Fee
+		change.Shares[ticker] = -shares
+		trades = append(trades, trade)
+	}
+	change.Funds -= p.Loan
+	change.Loan = -p.Loan
+
+	updated, err := s.Store.ApplyBatch(ctx, store.Batch{
+		Changes:      []store.PortfolioChange{change},
+		Trades:       trades,
+		Transactions: trades,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Liquidated %d positions of %s at margin ratio %.3f", len(trades), p.Player, status.Ratio)
+	data := s.marginEventData(p.Player, status)
+	data["trades"] = trades
+	s.Hub.Broadcast <- models.WSMessage{
+		Event: "forced_liquidation",
+		Data:  data,
+	}
+	for _, trade := range trades {
+		s.broadcastTrade(trade, updated[0])
+	}
+	s.broadcastPortfolio(updated[0])
+	return nil
+}
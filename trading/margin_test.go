@@ -0,0 +1,74 @@
+package trading
+
+import (
+	"context"
+	"testing"
+
+	"midnight-trader/models"
+)
+
+func TestLiquidationCancelsOrders(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	if _, _, err := s.Trade(ctx, "alice", "NMBS", "sell", 100); err != nil {
+		t.Fatalf("Trade: %v", err)
+	}
+	order, _, err := s.PlaceOrder(ctx, models.Order{
+		Player: "alice", Ticker: "NMBS", Side: "buy", Type: "limit", Price: 25, Quantity: 10,
+	})
+	if err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	if _, err := s.PlaceConditionalOrder(ctx, models.ConditionalOrder{
+		Player: "alice", Ticker: "NMBS", Side: "buy", Type: "stop_loss", TriggerPrice: 500, Quantity: 100,
+	}); err != nil {
+		t.Fatalf("PlaceConditionalOrder: %v", err)
+	}
+
+	// The short position now costs more than the whole portfolio is worth.
+	if err := s.Store.AppendCompanyPrices(ctx, "NMBS", []float64{140}); err != nil {
+		t.Fatalf("AppendCompanyPrices: %v", err)
+	}
+	s.MarginTick(ctx)
+
+	p := mustPortfolio(t, s, "alice")
+	if len(p.Companies) != 0 || len(p.ReservedShares) != 0 || p.ReservedFunds != 0 || p.Loan != 0 {
+		t.Errorf("alice = %+v, want no positions, reservations or loan left", p)
+	}
+	if _, ok := s.Exchange.Order(order.ID); ok {
+		t.Error("order still rests on the book")
+	}
+	if pending, _ := s.Store.ListPendingConditionalOrders(ctx); len(pending) != 0 {
+		t.Errorf("conditional orders %+v still pending", pending)
+	}
+
+	trades, _ := s.Store.ListTrades(ctx, "alice")
+	last := trades[len(trades)-1]
+	if !last.Liquidation || last.Type != "buy" || last.Amount != 100 || last.Price != 140 {
+		t.Errorf("last trade = %+v, want a liquidation buying 100 at 140", last)
+	}
+}
+
+func TestLiquidationSellsReservedShares(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	// 300 shares at 50 with 10000 in funds borrows 5000.
+	if _, _, err := s.Trade(ctx, "alice", "NMBS", "buy", 300); err != nil {
+		t.Fatalf("Trade: %v", err)
+	}
+	if _, _, err := s.PlaceOrder(ctx, models.Order{
+		Player: "alice", Ticker: "NMBS", Side: "sell", Type: "limit", Price: 100, Quantity: 120,
+	}); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+
+	if err := s.Store.AppendCompanyPrices(ctx, "NMBS", []float64{20}); err != nil {
+		t.Fatalf("AppendCompanyPrices: %v", err)
+	}
+	s.MarginTick(ctx)
+
+	p := mustPortfolio(t, s, "alice")
+	if len(p.Companies) != 0 || len(p.ReservedShares) != 0 || p.Loan != 0 {
+		t.Errorf("alice = %+v, want every share sold and the loan repaid", p)
+	}
+}
@@ -0,0 +1,349 @@
+package trading
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+
+	"midnight-trader/models"
+	"midnight-trader/orderbook"
+	"midnight-trader/store"
+)
+
+// RestoreOrderBooks puts every persisted open order back on the exchange.
+func (s *Service) RestoreOrderBooks(ctx context.Context) error {
+	orders, err := s.Store.ListOpenOrders(ctx)
+	if err != nil {
+		return err
+	}
+	for _, o := range orders {
+		s.Exchange.Restore(o)
+	}
+	log.Printf("Restored %d open orders", len(orders))
+	return nil
+}
+
+// newExchange returns an empty exchange that charges Fees on every fill.
+func (s *Service) newExchange() *orderbook.Exchange {
+	e := orderbook.NewExchange()
+	e.Fee = func(value float64) float64 {
+		return s.Fees.Fee(value)
+	}
+	return e
+}
+
+// ResetOrderBooks discards every resting and conditional order without
+// releasing what they hold. It is only meant for use after all game data has
+// been cleared.
+func (s *Service) ResetOrderBooks() {
+	s.orderMu.Lock()
+	defer s.orderMu.Unlock()
+	s.Exchange = s.newExchange()
+
+	s.conditionalMu.Lock()
+	defer s.conditionalMu.Unlock()
+	s.conditional = make(map[string]*models.ConditionalOrder)
+}
+
+// PlaceOrder reserves the funds or shares an order needs, submits it to the
+// exchange and settles any resulting fills. It returns the final state of the
+// order and the fills it produced.
+func (s *Service) PlaceOrder(ctx context.Context, order models.Order) (models.Order, []orderbook.Fill, error) {
+	if err := orderbook.Validate(order); err != nil {
+		return order, nil, err
+	}
+
+	company, err := s.company(ctx, order.Ticker)
+	if err != nil {
+		return order, nil, err
+	}
+
+	s.orderMu.Lock()
+	defer s.orderMu.Unlock()
+
+	portfolio, _, err := s.Portfolio(ctx, order.Player)
+	if err != nil {
+		return order, nil, err
+	}
+
+	// Hold back what the order may consume until it is filled or cancelled:
+	// a buy holds the fee as well. A market buy holds all free funds, and
+	// the exchange only fills as many shares as they pay for with the fee.
+	change := store.PortfolioChange{Player: order.Player}
+	switch order.Side {
+	case "buy":
+		value := order.Price * float64(order.Quantity)
+		reserve := value + s.Fees.Fee(value)
+		if order.Type == "market" {
+			reserve = portfolio.Funds
+		}
+		if reserve <= 0 {
+			return order, nil, ErrInsufficientFunds
+		}
+		change.Funds = -reserve
+		change.ReservedFunds = reserve
+		order.Reserved = reserve
+	case "sell":
+		change.Shares = map[string]int{order.Ticker: -order.Quantity}
+		change.ReservedShares = map[string]int{order.Ticker: order.Quantity}
+		order.Reserved = 0
+	}
+	_, err = s.Store.ApplyBatch(ctx, store.Batch{Changes: []store.PortfolioChange{change}})
+	if err == store.ErrInsufficient {
+		if order.Side == "buy" {
+			return order, nil, ErrInsufficientFunds
+		}
+		return order, nil, ErrInsufficientShares
+	}
+	if err != nil {
+		return order, nil, err
+	}
+
+	result, fills, completed, err := s.Exchange.Submit(order)
+	if err != nil {
+		return order, nil, err
+	}
+
+	// A fill that fails to settle leaves both portfolios as they were, so it
+	// and every later fill are taken back off the books and the order is
+	// cancelled.
+	var settleErr error
+	for i, fill := range fills {
+		if err := s.settleFill(ctx, *company, fill); err != nil {
+			settleErr = fmt.Errorf("failed to settle fill for order %s: %v", result.ID, err)
+			completed = s.revertFills(&result, fills[i:], completed)
+			fills = fills[:i]
+			break
+		}
+	}
+	for _, maker := range completed {
+		if err := s.releaseOrder(ctx, &maker); err != nil {
+			log.Printf("Failed to release order %s: %v", maker.ID, err)
+		}
+		if err := s.Store.SaveOrder(ctx, maker); err != nil {
+			log.Printf("Failed to save order %s: %v", maker.ID, err)
+		}
+	}
+	if !result.IsOpen() {
+		if err := s.releaseOrder(ctx, &result); err != nil {
+			return result, fills, err
+		}
+	}
+	if err := s.Store.SaveOrder(ctx, result); err != nil {
+		return result, fills, err
+	}
+
+	s.Hub.Broadcast <- models.WSMessage{
+		Event: "order_placed",
+		Data:  result,
+	}
+	s.broadcastOrderBook(order.Ticker)
+
+	if len(fills) > 0 {
+		lastPrice := fills[len(fills)-1].Price
+		if err := s.Store.AppendCompanyPrices(ctx, order.Ticker, []float64{lastPrice}); err != nil {
+			log.Printf("Failed to record last price for %s: %v", order.Ticker, err)
+		} else {
+			s.PublishPrice(order.Ticker, lastPrice)
+		}
+		s.BroadcastPortfolios(ctx)
+	}
+	return result, fills, settleErr
+}
+
+// revertFills takes fills of order that could not be settled back off the
+// books and cancels what is left of order. It returns the resting orders
+// that were still completed by the fills before them. Callers must hold
+// orderMu.
+func (s *Service) revertFills(order *models.Order, fills []orderbook.Fill, completed []models.Order) []models.Order {
+	reverted := make(map[string]bool)
+	for _, maker := range s.Exchange.Revert(fills) {
+		reverted[maker.ID] = true
+	}
+	completed = slices.DeleteFunc(completed, func(o models.Order) bool {
+		return reverted[o.ID]
+	})
+
+	for _, fill := range fills {
+		order.Filled -= fill.Quantity
+		if order.Side == "buy" {
+			order.Reserved += fill.Price*float64(fill.Quantity) + fill.Fee
+		}
+	}
+	if order.IsOpen() {
+		s.Exchange.Cancel(order.ID, order.Player)
+	}
+	order.Status = "cancelled"
+	return completed
+}
+
+// settleFill moves cash and shares between the two players of a fill and
+// records a trade for each side, all in one atomic batch. Each side pays the
+// fee of the fill: the buyer out of its reservation, the seller out of the
+// proceeds.
+func (s *Service) settleFill(ctx context.Context, company models.Company, fill orderbook.Fill) error {
+	cost := fill.Price * float64(fill.Quantity)
+	fee := fill.Fee
+
+	trades := []models.Trade{
+		{
+			Player:       fill.Buy.Player,
+			Company:      company.Name,
+			Ticker:       fill.Ticker,
+			Type:         "buy",
+			Amount:       fill.Quantity,
+			Price:        fill.Price,
+			Fee:          fee,
+			Timestamp:    fill.Timestamp,
+			OrderID:      fill.Buy.ID,
+			Counterparty: fill.Sell.Player,
+		},
+		{
+			Player:       fill.Sell.Player,
+			Company:      company.Name,
+			Ticker:       fill.Ticker,
+			Type:         "sell",
+			Amount:       fill.Quantity,
+			Price:        fill.Price,
+			Fee:          fee,
+			Timestamp:    fill.Timestamp,
+			OrderID:      fill.Sell.ID,
+			Counterparty: fill.Buy.Player,
+		},
+	}
+	portfolios, err := s.Store.ApplyBatch(ctx, store.Batch{
+		Changes: []store.PortfolioChange{
+			{
+				Player:        fill.Buy.Player,
+				ReservedFunds: -cost - fee,
+				Shares:        map[string]int{fill.Ticker: fill.Quantity},
+				Fees:          fee,
+			},
+			{
+				Player:         fill.Sell.Player,
+				Funds:          cost - fee,
+				ReservedShares: map[string]int{fill.Ticker: -fill.Quantity},
+				Fees:           fee,
+			},
+		},
+		Trades:       trades,
+		Transactions: trades,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Persist the latest state of the resting side of the fill. The fill is
+	// settled by now, so a failure here must not undo it.
+	maker := fill.Sell
+	if fill.Sell.Sequence > fill.Buy.Sequence {
+		maker = fill.Buy
+	}
+	if maker.IsOpen() {
+		if err := s.Store.SaveOrder(ctx, maker); err != nil {
+			log.Printf("Failed to save order %s: %v", maker.ID, err)
+		}
+	}
+
+	for i, trade := range trades {
+		s.broadcastTrade(trade, portfolios[i])
+		s.broadcastPortfolio(portfolios[i])
+	}
+	return nil
+}
+
+// releaseOrder returns whatever a closed order still holds to its owner:
+// unspent funds for a buy, unsold shares for a sell.
+func (s *Service) releaseOrder(ctx context.Context, order *models.Order) error {
+	change := store.PortfolioChange{Player: order.Player}
+	if order.Side == "buy" {
+		if order.Reserved <= 0 {
+			return nil
+		}
+		change.ReservedFunds = -order.Reserved
+		change.Funds = order.Reserved
+	} else {
+		remaining := order.Remaining()
+		if remaining <= 0 {
+			return nil
+		}
+		change.ReservedShares = map[string]int{order.Ticker: -remaining}
+		change.Shares = map[string]int{order.Ticker: remaining}
+	}
+
+	if _, err := s.Store.ApplyBatch(ctx, store.Batch{Changes: []store.PortfolioChange{change}}); err != nil {
+		return err
+	}
+	order.Reserved = 0
+	return nil
+}
+
+// CancelOrder removes a player's resting order and releases what it held.
+func (s *Service) CancelOrder(ctx context.Context, player, id string) (models.Order, error) {
+	s.orderMu.Lock()
+	defer s.orderMu.Unlock()
+
+	order, err := s.cancelOrder(ctx, player, id)
+	if err != nil {
+		return order, err
+	}
+
+	s.Hub.Broadcast <- models.WSMessage{
+		Event: "order_cancelled",
+		Data:  order,
+	}
+	s.broadcastOrderBook(order.Ticker)
+	return order, nil
+}
+
+// CancelAllOrders cancels every resting and conditional order owned by
+// player.
+func (s *Service) CancelAllOrders(ctx context.Context, player string) error {
+	s.orderMu.Lock()
+	defer s.orderMu.Unlock()
+
+	for _, o := range s.Exchange.OpenOrders(player) {
+		if _, err := s.cancelOrder(ctx, player, o.ID); err != nil {
+			return fmt.Errorf("failed to cancel order %s: %v", o.ID, err)
+		}
+		s.broadcastOrderBook(o.Ticker)
+	}
+	return s.cancelConditionalOrders(ctx, player)
+}
+
+// cancelOrder is CancelOrder for callers that already hold orderMu.
+func (s *Service) cancelOrder(ctx context.Context, player, id string) (models.Order, error) {
+	order, err := s.Exchange.Cancel(id, player)
+	if err != nil {
+		return order, err
+	}
+	if err := s.releaseOrder(ctx, &order); err != nil {
+		return order, err
+	}
+	if err := s.Store.SaveOrder(ctx, order); err != nil {
+		return order, err
+	}
+	return order, nil
+}
+
+// OrderBook returns the aggregated bids and asks for ticker.
+func (s *Service) OrderBook(ticker string) (bids, asks []orderbook.Level) {
+	s.orderMu.Lock()
+	defer s.orderMu.Unlock()
+	return s.Exchange.Depth(ticker)
+}
+
+// broadcastOrderBook emits the current depth of ticker's book. Callers must
+// hold orderMu.
+func (s *Service) broadcastOrderBook(ticker string) {
+	bids, asks := s.Exchange.Depth(ticker)
+	s.Hub.Broadcast <- models.WSMessage{
+		Event: "order_book",
+		Data: map[string]interface{}{
+			"ticker": ticker,
+			"bids":   bids,
+			"asks":   asks,
+		},
+	}
+}
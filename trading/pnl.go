@@ -0,0 +1,45 @@
+package trading
+
+import (
+	"context"
+
+	"midnight-trader/models"
+)
+
+// PnL summarizes a portfolio's profit and loss at current prices.
+type PnL struct {
+	Equity float64 `json:"equity"`
+	// Profit is the equity gained over StartingFunds, after fees.
+	Profit           float64 `json:"profit"`
+	Fees             float64 `json:"fees"`
+	ProfitBeforeFees float64 `json:"profitBeforeFees"`
+}
+
+// PnL returns the profit and loss of p at current prices.
+func (s *Service) PnL(ctx context.Context, p models.Portfolio) PnL {
+	equity := s.PortfolioValue(ctx, p)
+	return PnL{
+		Equity:           equity,
+		Profit:           equity - StartingFunds,
+		Fees:             p.FeesPaid,
+		ProfitBeforeFees: equity - StartingFunds + p.FeesPaid,
+	}
+}
+
+// Equities returns the net equity of every portfolio at current prices, by
+// player.
+func (s *Service) Equities(ctx context.Context) (map[string]float64, error) {
+	portfolios, err := s.Store.ListPortfolios(ctx)
+	if err != nil {
+		return nil, err
+	}
+	prices, err := s.currentPrices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	equities := make(map[string]float64, len(portfolios))
+	for _, p := range portfolios {
+		equities[p.Player] = marginStatus(p, prices).Equity
+	}
+	return equities, nil
+}
@@ -0,0 +1,464 @@
+// Package trading is the single entry point for everything that changes a
+// player's holdings. HTTP handlers and the round system both go through a
+// Service, so persisted portfolios, the trade log and WebSocket events always
+// agree no matter how a trade was submitted.
+package trading
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"midnight-trader/market"
+	"midnight-trader/models"
+	"midnight-trader/orderbook"
+	"midnight-trader/store"
+)
+
+// StartingFunds is the cash every new or reset portfolio starts with.
+const StartingFunds = 10000.0
+
+var (
+	ErrCompanyNotFound    = errors.New("company not found")
+	ErrInsufficientFunds  = errors.New("insufficient funds")
+	ErrInsufficientShares = errors.New("not enough stock to sell")
+	ErrPortfolioExists    = errors.New("portfolio already exists")
+	ErrInsufficientMargin = errors.New("insufficient margin")
+	ErrNoPosition         = errors.New("no shares left to sell")
+)
+
+// Service executes trades against a store and announces them on a hub.
+type Service struct {
+	Store    store.Store
+	Hub      *models.Hub
+	Exchange *orderbook.Exchange
+	// RoundID returns the ID of the active round, or 0 when there is none.
+	// It is used to tag portfolio events.
+	RoundID func() int
+	// Margin sets the requirements for short positions and borrowing.
+	Margin MarginConfig
+	// Fees is the commission charged on every trade.
+	Fees FeeConfig
+	// Impact is the liquidity model that moves prices on trades at market.
+	Impact ImpactConfig
+	// CostMethod is the cost basis method of the P&L in portfolio events.
+	CostMethod string
+	// Indicators follows price updates with a "stock_indicators" event
+	// carrying the latest technical indicators of the company.
+	Indicators bool
+
+	// marketMu serializes trades at market so that each one moves the
+	// price left by the one before.
+	marketMu sync.Mutex
+	// marginMu serializes trades on margin so that two of them can't both
+	// pass the margin check on the same equity.
+	marginMu sync.Mutex
+	// conditional holds the pending conditional orders by ID.
+	conditional   map[string]*models.ConditionalOrder
+	conditionalMu sync.Mutex
+
+	// prices collects prices published since watchPrices last ran, and
+	// pricesChanged wakes it up.
+	prices        map[string]float64
+	pricesMu      sync.Mutex
+	pricesChanged chan struct{}
+
+	// orderMu serializes order placement and cancellation so that order
+	// records are persisted in the same sequence the exchange produced them.
+	// Balances do not depend on it: every portfolio update is an atomic batch.
+	orderMu sync.Mutex
+}
+
+// NewService returns a Service with an empty exchange. Conditional orders are
+// not evaluated until Start is called.
+func NewService(s store.Store, hub *models.Hub) *Service {
+	service := &Service{
+		Store:         s,
+		Hub:           hub,
+		RoundID:       func() int { return 0 },
+		Margin:        DefaultMargin,
+		CostMethod:    CostFIFO,
+		conditional:   make(map[string]*models.ConditionalOrder),
+		prices:        make(map[string]float64),
+		pricesChanged: make(chan struct{}, 1),
+	}
+	service.Exchange = service.newExchange()
+	return service
+}
+
+// Start evaluates conditional orders on published prices from now on. It is
+// kept out of NewService so that setting up a service that fails half way
+// doesn't leave the watcher running.
+func (s *Service) Start() {
+	go s.watchPrices()
+}
+
+func newPortfolio(player string) models.Portfolio {
+	return models.Portfolio{
+		Player:    player,
+		Funds:     StartingFunds,
+		Companies: make(map[string]int),
+		Since:     time.Now(),
+	}
+}
+
+// CreatePortfolio creates a new portfolio, failing with ErrPortfolioExists if
+// the player already has one.
+func (s *Service) CreatePortfolio(ctx context.Context, player string) (*models.Portfolio, error) {
+	portfolio := newPortfolio(player)
+	err := s.Store.CreatePortfolio(ctx, portfolio)
+	if err == store.ErrDuplicate {
+		return nil, ErrPortfolioExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &portfolio, nil
+}
+
+// Portfolio returns a player's portfolio, creating it if it doesn't exist.
+// The boolean reports whether it was created.
+func (s *Service) Portfolio(ctx context.Context, player string) (*models.Portfolio, bool, error) {
+	existing, err := s.Store.GetPortfolio(ctx, player)
+	if err == nil {
+		return existing, false, nil
+	}
+	if err != store.ErrNotFound {
+		return nil, false, err
+	}
+
+	created, err := s.CreatePortfolio(ctx, player)
+	if err == ErrPortfolioExists {
+		// Another request created it first; return that one instead.
+		existing, err = s.Store.GetPortfolio(ctx, player)
+		if err != nil {
+			return nil, false, err
+		}
+		return existing, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return created, true, nil
+}
+
+// ResetPortfolio cancels a player's open orders and restores their portfolio
+// to the starting state, creating it if needed.
+func (s *Service) ResetPortfolio(ctx context.Context, player string) (*models.Portfolio, error) {
+	if _, _, err := s.Portfolio(ctx, player); err != nil {
+		return nil, err
+	}
+	if err := s.CancelAllOrders(ctx, player); err != nil {
+		return nil, err
+	}
+
+	portfolio := newPortfolio(player)
+	if err := s.Store.SavePortfolio(ctx, portfolio); err != nil {
+		return nil, err
+	}
+	s.broadcastPortfolio(portfolio)
+	return &portfolio, nil
+}
+
+// DeletePortfolio cancels a player's open and conditional orders, so that
+// nothing is left on the books for a player who no longer exists, and then
+// deletes their portfolio.
+func (s *Service) DeletePortfolio(ctx context.Context, player string) error {
+	if err := s.CancelAllOrders(ctx, player); err != nil {
+		return err
+	}
+	return s.Store.DeletePortfolio(ctx, player)
+}
+
+// Price returns the current stock price of ticker.
+func (s *Service) Price(ctx context.Context, ticker string) (float64, error) {
+	company, err := s.company(ctx, ticker)
+	if err != nil {
+		return 0, err
+	}
+	return company.StockPrice, nil
+}
+
+func (s *Service) company(ctx context.Context, ticker string) (*models.Company, error) {
+	company, err := s.Store.GetCompany(ctx, ticker)
+	if err == store.ErrNotFound {
+		return nil, ErrCompanyNotFound
+	}
+	return company, err
+}
+
+// CompanyCandles aggregates every recorded price of ticker, and the trades
+// since the first of them, into candles of length interval, or one candle
+// per price tick if interval is 0.
+func (s *Service) CompanyCandles(ctx context.Context, ticker string, interval time.Duration) ([]models.Candle, error) {
+	if _, err := s.company(ctx, ticker); err != nil {
+		return nil, err
+	}
+	ticks, err := s.Store.ListPriceTicks(ctx, ticker, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	// Trades from before the first tick predate the company's history.
+	var since time.Time
+	if len(ticks) > 0 {
+		since = ticks[0].Time
+	}
+	trades, err := s.Store.ListTickerTrades(ctx, ticker, since)
+	if err != nil {
+		return nil, err
+	}
+	if interval == 0 {
+		return market.TickCandles(ticks, trades), nil
+	}
+	return market.Candles(ticks, trades, interval), nil
+}
+
+// PortfolioValue returns the net equity of a portfolio at current prices:
+// funds and shares, including those held by open orders, minus short
+// positions and the margin loan.
+func (s *Service) PortfolioValue(ctx context.Context, p models.Portfolio) float64 {
+	total := p.Funds + p.ReservedFunds - p.Loan
+	for _, holdings := range []map[string]int{p.Companies, p.ReservedShares} {
+		for ticker, shares := range holdings {
+			price, err := s.Price(ctx, ticker)
+			if err != nil {
+				log.Printf("PortfolioValue: no price for %s: %v", ticker, err)
+				continue
+			}
+			total += float64(shares) * price
+		}
+	}
+	return total
+}
+
+// Trade buys or sells quantity shares of ticker for player at market,
+// charging the trading fee on top. The order moves the stock price as set by
+// Impact and fills at the average price along the way; the new price is
+// recorded and published afterwards. The portfolio update and the trade log
+// entries are written in one atomic batch. Selling more shares than
+// the player holds opens or extends a short position, and with leverage
+// enabled a buy borrows the cash the player lacks; either must meet the
+// initial margin requirement. Buying while short covers the position first,
+// and sale proceeds pay down the loan first.
+func (s *Service) Trade(ctx context.Context, player, ticker, side string, quantity int) (models.Trade, *models.Portfolio, error) {
+	return s.trade(ctx, player, ticker, side, quantity, false)
+}
+
+// trade is Trade. With exit set, a sale only closes the position: it sells
+// at most the shares the player holds, failing with ErrNoPosition if there
+// are none, and never opens a short.
+func (s *Service) trade(ctx context.Context, player, ticker, side string, quantity int, exit bool) (models.Trade, *models.Portfolio, error) {
+	if player == "" || ticker == "" {
+		return models.Trade{}, nil, fmt.Errorf("player and ticker must not be empty")
+	}
+	if quantity <= 0 {
+		return models.Trade{}, nil, fmt.Errorf("quantity must be positive")
+	}
+	if side != "buy" && side != "sell" {
+		return models.Trade{}, nil, fmt.Errorf("invalid trade type, must be 'buy' or 'sell'")
+	}
+
+	s.marketMu.Lock()
+	defer s.marketMu.Unlock()
+
+	company, err := s.company(ctx, ticker)
+	if err != nil {
+		return models.Trade{}, nil, err
+	}
+	if company.StockPrice <= 0 {
+		return models.Trade{}, nil, fmt.Errorf("price must be positive")
+	}
+	// Make sure the portfolio exists before updating it.
+	portfolio, _, err := s.Portfolio(ctx, player)
+	if err != nil {
+		return models.Trade{}, nil, err
+	}
+	if exit && side == "sell" {
+		quantity = min(quantity, portfolio.Companies[ticker])
+		if quantity <= 0 {
+			return models.Trade{}, nil, ErrNoPosition
+		}
+	}
+	price, after := s.Impact.Fill(*company, side, quantity)
+	total := price * float64(quantity)
+	fee := s.Fees.Fee(total)
+	onMargin := (side == "sell" && quantity > portfolio.Companies[ticker]) ||
+		(side == "buy" && total+fee > portfolio.Funds && s.Margin.Leverage)
+	if onMargin {
+		s.marginMu.Lock()
+		defer s.marginMu.Unlock()
+
+		// Re-read under the lock so the check sees every earlier margin trade.
+		if portfolio, err = s.Store.GetPortfolio(ctx, player); err != nil {
+			return models.Trade{}, nil, err
+		}
+	}
+
+	trade := models.Trade{
+		Player:      player,
+		Company:     company.Name,
+		Ticker:      ticker,
+		Type:        side,
+		Amount:      quantity,
+		Price:       price,
+		MarketPrice: company.StockPrice,
+		Fee:         fee,
+		Timestamp:   time.Now(),
+	}
+	change := store.PortfolioChange{Player: player, Fees: fee}
+	if side == "buy" {
+		cost := total + fee
+		change.Funds = -cost
+		change.Shares = map[string]int{ticker: quantity}
+		if borrow := cost - max(portfolio.Funds, 0); borrow > 0 && s.Margin.Leverage {
+			change.Funds = -max(portfolio.Funds, 0)
+			change.Loan = borrow
+		}
+	} else {
+		proceeds := total - fee
+		change.Funds = proceeds
+		change.Shares = map[string]int{ticker: -quantity}
+		change.AllowShort = quantity > portfolio.Companies[ticker]
+		if repay := min(portfolio.Loan, max(proceeds, 0)); repay > 0 {
+			change.Funds -= repay
+			change.Loan = -repay
+		}
+	}
+	if onMargin {
+		if err := s.checkInitialMargin(ctx, *portfolio, change); err != nil {
+			return trade, nil, err
+		}
+	}
+
+	// The balance check and the update happen atomically in the store, so
+	// concurrent trades can never spend the same money or shares twice.
+	updated, err := s.Store.ApplyBatch(ctx, store.Batch{
+		Changes:      []store.PortfolioChange{change},
+		Trades:       []models.Trade{trade},
+		Transactions: []models.Trade{trade},
+	})
+	if err == store.ErrInsufficient {
+		if side == "buy" {
+			return trade, nil, ErrInsufficientFunds
+		}
+		return trade, nil, ErrInsufficientShares
+	}
+	if err != nil {
+		return trade, nil, err
+	}
+
+	if after != company.StockPrice {
+		if err := s.Store.AppendCompanyPrices(ctx, ticker, []float64{after}); err != nil {
+			log.Printf("Failed to record price impact on %s: %v", ticker, err)
+		} else {
+			s.PublishPrice(ticker, after)
+		}
+	}
+
+	s.broadcastTrade(trade, updated[0])
+	s.broadcastPortfolio(updated[0])
+	s.BroadcastPortfolios(ctx)
+	return trade, &updated[0], nil
+}
+
+// MoveMarket runs move while no trade at market can change a price. Code
+// that computes new prices from the stored ones and appends them must run
+// inside it, or a trade's price impact landing in between is overwritten.
+// move must not trade.
+func (s *Service) MoveMarket(move func() error) error {
+	s.marketMu.Lock()
+	defer s.marketMu.Unlock()
+	return move()
+}
+
+// AdjustFunds adds amount (which may be negative) to a player's cash.
+func (s *Service) AdjustFunds(ctx context.Context, player string, amount float64) (*models.Portfolio, error) {
+	if _, _, err := s.Portfolio(ctx, player); err != nil {
+		return nil, err
+	}
+	updated, err := s.Store.ApplyBatch(ctx, store.Batch{
+		Changes: []store.PortfolioChange{{Player: player, Funds: amount}},
+	})
+	if err == store.ErrInsufficient {
+		return nil, ErrInsufficientFunds
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.broadcastPortfolio(updated[0])
+	s.BroadcastPortfolios(ctx)
+	return &updated[0], nil
+}
+
+// broadcastTrade emits the "trade_executed" event for one side of a trade.
+func (s *Service) broadcastTrade(trade models.Trade, portfolio models.Portfolio) {
+	data := map[string]interface{}{
+		"player":    trade.Player,
+		"ticker":    trade.Ticker,
+		"quantity":  trade.Amount,
+		"price":     trade.Price,
+		"type":      trade.Type,
+		"timestamp": trade.Timestamp,
+		"portfolio": portfolio,
+	}
+	if trade.MarketPrice != 0 && trade.MarketPrice != trade.Price {
+		data["marketPrice"] = trade.MarketPrice
+	}
+	if trade.OrderID != "" {
+		data["orderId"] = trade.OrderID
+		data["counterparty"] = trade.Counterparty
+	}
+	s.Hub.Broadcast <- models.WSMessage{
+		Event: "trade_executed",
+		Data:  data,
+	}
+}
+
+// broadcastPortfolio emits the "portfolio_updated" event for a player.
+// Short positions show up as negative share counts; portfolios on margin
+// also carry their loan and margin ratio. The event includes the realized
+// and unrealized P&L and the cost basis of every position.
+func (s *Service) broadcastPortfolio(portfolio models.Portfolio) {
+	data := map[string]interface{}{
+		"round_id":  s.RoundID(),
+		"player":    portfolio.Player,
+		"companies": portfolio.Companies,
+		"funds":     portfolio.Funds,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if onMargin(portfolio) {
+		if status, err := s.MarginStatus(ctx, portfolio); err == nil {
+			data["loan"] = status.Loan
+			data["margin_ratio"] = status.Ratio
+		}
+	}
+	if perf, err := s.Performance(ctx, portfolio, s.CostMethod); err == nil {
+		data["realized_pnl"] = perf.RealizedPnL
+		data["unrealized_pnl"] = perf.UnrealizedPnL
+		data["positions"] = perf.Positions
+	} else {
+		log.Printf("Failed to compute P&L for %s: %v", portfolio.Player, err)
+	}
+	s.Hub.Broadcast <- models.WSMessage{
+		Event: "portfolio_updated",
+		Data:  data,
+	}
+}
+
+// BroadcastPortfolios emits the "all_portfolios" event.
+func (s *Service) BroadcastPortfolios(ctx context.Context) {
+	portfolios, err := s.Store.ListPortfolios(ctx)
+	if err != nil {
+		log.Println("Failed to fetch portfolios for broadcast:", err)
+		return
+	}
+	s.Hub.Broadcast <- models.WSMessage{
+		Event: "all_portfolios",
+		Data:  portfolios,
+	}
+}
@@ -0,0 +1,340 @@
+package trading
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"midnight-trader/models"
+	"midnight-trader/store"
+)
+
+const testPrice = 50.0
+
+// newTestService returns a Service over a memory store holding one company
+// at testPrice, charging the default fees without price impact.
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	st := store.NewMemoryStore()
+	err := st.ReplaceCompanies(context.Background(), []models.Company{{
+		Name:                  "Nimbus",
+		Ticker:                "NMBS",
+		StockPrice:            testPrice,
+		HistoricalStockPrices: []float64{testPrice},
+	}})
+	if err != nil {
+		t.Fatalf("ReplaceCompanies: %v", err)
+	}
+	hub := models.NewHub()
+	go hub.Run()
+
+	s := NewService(st, hub)
+	s.Fees = DefaultFees
+	s.Start()
+	return s
+}
+
+func mustPortfolio(t *testing.T, s *Service, player string) models.Portfolio {
+	t.Helper()
+	p, _, err := s.Portfolio(context.Background(), player)
+	if err != nil {
+		t.Fatalf("Portfolio(%s): %v", player, err)
+	}
+	return *p
+}
+
+// conserved is everything a portfolio started with: cash and shares, held
+// back or not, net of the loan, plus the fees it has paid. Without price
+// impact no trade can change it.
+func conserved(p models.Portfolio) float64 {
+	value := p.Funds + p.ReservedFunds - p.Loan + p.FeesPaid
+	for _, holdings := range []map[string]int{p.Companies, p.ReservedShares} {
+		for _, shares := range holdings {
+			value += float64(shares) * testPrice
+		}
+	}
+	return value
+}
+
+func TestConcurrentTradesConserveValue(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	mustPortfolio(t, s, "alice")
+
+	const workers, rounds = 8, 25
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range rounds {
+				side := "buy"
+				if (w+i)%2 == 1 {
+					side = "sell"
+				}
+				if _, _, err := s.Trade(ctx, "alice", "NMBS", side, 1+i%7); err != nil &&
+					err != ErrInsufficientFunds && err != ErrInsufficientShares && err != ErrInsufficientMargin {
+					t.Errorf("Trade: %v", err)
+				}
+
+				// Resting orders far from the price hold funds and shares
+				// back without ever filling.
+				price := testPrice / 2
+				if side == "sell" {
+					price = testPrice * 2
+				}
+				_, _, err := s.PlaceOrder(ctx, models.Order{
+					Player: "alice", Ticker: "NMBS", Side: side, Type: "limit", Price: price, Quantity: 1 + i%3,
+				})
+				if err != nil && err != ErrInsufficientFunds && err != ErrInsufficientShares {
+					t.Errorf("PlaceOrder: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	p := mustPortfolio(t, s, "alice")
+	if got := conserved(p); math.Abs(got-StartingFunds) > 1e-6 {
+		t.Errorf("funds, positions and fees add up to %v, want %v: %+v", got, StartingFunds, p)
+	}
+	if p.FeesPaid == 0 {
+		t.Error("no trade went through")
+	}
+	if p.ReservedFunds == 0 && len(p.ReservedShares) == 0 {
+		t.Error("no order rests on the book")
+	}
+
+	if err := s.CancelAllOrders(ctx, "alice"); err != nil {
+		t.Fatalf("CancelAllOrders: %v", err)
+	}
+	p = mustPortfolio(t, s, "alice")
+	if math.Abs(p.ReservedFunds) > 1e-6 || len(p.ReservedShares) != 0 {
+		t.Errorf("cancelling every order left %v funds and %v shares reserved", p.ReservedFunds, p.ReservedShares)
+	}
+	if got := conserved(p); math.Abs(got-StartingFunds) > 1e-6 {
+		t.Errorf("after cancelling, funds, positions and fees add up to %v, want %v", got, StartingFunds)
+	}
+}
+
+func TestInsufficientLeavesPortfolioUntouched(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	s.Margin.Leverage = false
+	before := mustPortfolio(t, s, "alice")
+
+	if _, _, err := s.Trade(ctx, "alice", "NMBS", "buy", 1000); err != ErrInsufficientFunds {
+		t.Errorf("Trade: got %v, want ErrInsufficientFunds", err)
+	}
+	_, _, err := s.PlaceOrder(ctx, models.Order{
+		Player: "alice", Ticker: "NMBS", Side: "sell", Type: "limit", Price: testPrice, Quantity: 1,
+	})
+	if err != ErrInsufficientShares {
+		t.Errorf("PlaceOrder: got %v, want ErrInsufficientShares", err)
+	}
+
+	if after := mustPortfolio(t, s, "alice"); !reflect.DeepEqual(before, after) {
+		t.Errorf("portfolio changed from %+v to %+v", before, after)
+	}
+	trades, _ := s.Store.ListTrades(ctx, "")
+	transactions, _ := s.Store.ListTransactions(ctx, "")
+	if len(trades) != 0 || len(transactions) != 0 {
+		t.Errorf("got %d trades and %d transactions, want none", len(trades), len(transactions))
+	}
+}
+
+func TestFillSettlesBothSides(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	if _, _, err := s.Trade(ctx, "bob", "NMBS", "buy", 10); err != nil {
+		t.Fatalf("Trade: %v", err)
+	}
+
+	if _, _, err := s.PlaceOrder(ctx, models.Order{
+		Player: "alice", Ticker: "NMBS", Side: "buy", Type: "limit", Price: 40, Quantity: 10,
+	}); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	order, fills, err := s.PlaceOrder(ctx, models.Order{
+		Player: "bob", Ticker: "NMBS", Side: "sell", Type: "limit", Price: 35, Quantity: 4,
+	})
+	if err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	if order.Status != "filled" || len(fills) != 1 || fills[0].Price != 40 {
+		t.Fatalf("order %s with fills %+v, want filled at 40", order.Status, fills)
+	}
+
+	alice, bob := mustPortfolio(t, s, "alice"), mustPortfolio(t, s, "bob")
+	if alice.Companies["NMBS"] != 4 || alice.ReservedFunds != 240 {
+		t.Errorf("alice = %+v, want 4 shares and 240 still reserved", alice)
+	}
+	if bob.Companies["NMBS"] != 6 || len(bob.ReservedShares) != 0 {
+		t.Errorf("bob = %+v, want 6 shares and none reserved", bob)
+	}
+	// Shares change hands below the price, so value moves from bob to
+	// alice but none is created or lost.
+	if got := conserved(alice) + conserved(bob); math.Abs(got-2*StartingFunds) > 1e-6 {
+		t.Errorf("both portfolios add up to %v, want %v", got, 2*StartingFunds)
+	}
+}
+
+func TestFailedSettlementRevertsFills(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	if _, _, err := s.Trade(ctx, "bob", "NMBS", "buy", 10); err != nil {
+		t.Fatalf("Trade: %v", err)
+	}
+	maker, _, err := s.PlaceOrder(ctx, models.Order{
+		Player: "alice", Ticker: "NMBS", Side: "buy", Type: "limit", Price: 40, Quantity: 5,
+	})
+	if err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	// Going around the service leaves alice's order on the book with no
+	// portfolio to settle against.
+	if err := s.Store.DeletePortfolio(ctx, "alice"); err != nil {
+		t.Fatalf("DeletePortfolio: %v", err)
+	}
+	before := mustPortfolio(t, s, "bob")
+
+	order, fills, err := s.PlaceOrder(ctx, models.Order{
+		Player: "bob", Ticker: "NMBS", Side: "sell", Type: "limit", Price: 40, Quantity: 5,
+	})
+	if err == nil {
+		t.Fatal("PlaceOrder settled a fill against a missing portfolio")
+	}
+	if len(fills) != 0 || order.Status != "cancelled" || order.Filled != 0 {
+		t.Errorf("order %s with %d filled and fills %+v, want cancelled with none", order.Status, order.Filled, fills)
+	}
+	after := mustPortfolio(t, s, "bob")
+	if after.Funds != before.Funds || after.Companies["NMBS"] != before.Companies["NMBS"] || len(after.ReservedShares) != 0 {
+		t.Errorf("bob changed from %+v to %+v", before, after)
+	}
+	if resting, ok := s.Exchange.Order(maker.ID); !ok || resting.Filled != 0 || resting.Reserved != 201 {
+		t.Errorf("alice's order = %+v, want it back on the book unfilled", resting)
+	}
+}
+
+func TestDeletePortfolioCancelsOrders(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	order, _, err := s.PlaceOrder(ctx, models.Order{
+		Player: "alice", Ticker: "NMBS", Side: "buy", Type: "limit", Price: 40, Quantity: 5,
+	})
+	if err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	if _, err := s.PlaceConditionalOrder(ctx, models.ConditionalOrder{
+		Player: "alice", Ticker: "NMBS", Side: "sell", Type: "stop_loss", TriggerPrice: 30, Quantity: 1,
+	}); err != nil {
+		t.Fatalf("PlaceConditionalOrder: %v", err)
+	}
+
+	if err := s.DeletePortfolio(ctx, "alice"); err != nil {
+		t.Fatalf("DeletePortfolio: %v", err)
+	}
+	if _, ok := s.Exchange.Order(order.ID); ok {
+		t.Error("order still rests on the book")
+	}
+	if pending, _ := s.Store.ListPendingConditionalOrders(ctx); len(pending) != 0 {
+		t.Errorf("conditional orders %+v still pending", pending)
+	}
+	if _, err := s.Store.GetPortfolio(ctx, "alice"); err != store.ErrNotFound {
+		t.Errorf("GetPortfolio: got %v, want ErrNotFound", err)
+	}
+	if bids, _ := s.OrderBook("NMBS"); len(bids) != 0 {
+		t.Errorf("bids = %+v, want none", bids)
+	}
+}
+
+func TestBookBuysReserveTheFee(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	s.Margin.Leverage = false
+	if _, _, err := s.Trade(ctx, "bob", "NMBS", "buy", 101); err != nil {
+		t.Fatalf("Trade: %v", err)
+	}
+	if _, _, err := s.PlaceOrder(ctx, models.Order{
+		Player: "bob", Ticker: "NMBS", Side: "sell", Type: "limit", Price: 100, Quantity: 100,
+	}); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+
+	// alice's cash pays for exactly 100 shares at 100, so a market buy
+	// fills only the 99 that leave room for the fee.
+	_, fills, err := s.PlaceOrder(ctx, models.Order{
+		Player: "alice", Ticker: "NMBS", Side: "buy", Type: "market", Quantity: 100,
+	})
+	if err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	if len(fills) != 1 || fills[0].Quantity != 99 || fills[0].Fee != 9.9 {
+		t.Fatalf("fills = %+v, want 99 shares with a fee of 9.9", fills)
+	}
+	alice := mustPortfolio(t, s, "alice")
+	if math.Abs(alice.ReservedFunds) > 1e-6 || !approx(alice.Funds, 90.1) {
+		t.Errorf("alice = %+v, want 90.1 funds and none reserved", alice)
+	}
+
+	// A limit buy must hold its fee back too.
+	_, _, err = s.PlaceOrder(ctx, models.Order{
+		Player: "alice", Ticker: "NMBS", Side: "buy", Type: "limit", Price: alice.Funds, Quantity: 1,
+	})
+	if err != ErrInsufficientFunds {
+		t.Errorf("limit buy of all the cash: got %v, want ErrInsufficientFunds", err)
+	}
+	if _, _, err := s.PlaceOrder(ctx, models.Order{
+		Player: "alice", Ticker: "NMBS", Side: "buy", Type: "limit", Price: 89.1, Quantity: 1,
+	}); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	if _, _, err := s.PlaceOrder(ctx, models.Order{
+		Player: "bob", Ticker: "NMBS", Side: "sell", Type: "market", Quantity: 1,
+	}); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	alice = mustPortfolio(t, s, "alice")
+	if alice.Funds < 0 || math.Abs(alice.ReservedFunds) > 1e-6 || alice.Companies["NMBS"] != 100 {
+		t.Errorf("alice = %+v, want 100 shares and no funds left", alice)
+	}
+	if got := conserved(alice); !approx(got, StartingFunds+99*(testPrice-100)+(testPrice-89.1)) {
+		t.Errorf("alice's portfolio adds up to %v", got)
+	}
+}
+
+func TestTradeWaitsForMarketMove(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	s.Impact = DefaultImpact
+
+	done := make(chan models.Trade)
+	err := s.MoveMarket(func() error {
+		go func() {
+			trade, _, err := s.Trade(ctx, "alice", "NMBS", "buy", 100)
+			if err != nil {
+				t.Errorf("Trade: %v", err)
+			}
+			done <- trade
+		}()
+		// Give the trade every chance to read the price before the move
+		// stores the next one.
+		time.Sleep(20 * time.Millisecond)
+		return s.Store.AppendCompanyPrices(ctx, "NMBS", []float64{60})
+	})
+	if err != nil {
+		t.Fatalf("MoveMarket: %v", err)
+	}
+
+	trade := <-done
+	if trade.MarketPrice != 60 {
+		t.Errorf("trade at market price %v, want it to start from the moved price 60", trade.MarketPrice)
+	}
+	company, _ := s.Store.GetCompany(ctx, "NMBS")
+	if company.StockPrice <= 60 {
+		t.Errorf("price = %v, want the trade's impact on top of 60", company.StockPrice)
+	}
+}
@@ -36,8 +36,10 @@ func WebSocketBroadcaster() {
 	}
 }
 
-// ServeWs handles WebSocket requests from clients
-func ServeWs(h *models.Hub, w http.ResponseWriter, r *http.Request) {
+// ServeWs handles WebSocket requests from clients. The connection joins the
+// audience of the given room only, on behalf of the authenticated player.
+func ServeWs(room *controllers.Room, player string, w http.ResponseWriter, r *http.Request) {
+	h := room.Hub
 	var upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
@@ -51,7 +53,7 @@ func ServeWs(h *models.Hub, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	client := &models.Client{Conn: conn, Send: make(chan models.WSMessage, 256)}
+	client := &models.Client{Conn: conn, Send: make(chan models.WSMessage, 256), Player: player}
 	h.Register <- client
 
 	// Start read and write pumps
@@ -59,7 +61,7 @@ func ServeWs(h *models.Hub, w http.ResponseWriter, r *http.Request) {
 	go client.ReadPump(h)
 	// Send the current round state to the newly connected client
 	go func() {
-		currentRound := controllers.GetCurrentRound()
+		currentRound := room.Rounds.GetCurrentRound()
 		if currentRound != nil {
 			roundData, err := json.Marshal(currentRound)
 			if err != nil {
@@ -88,7 +90,7 @@ func ServeWs(h *models.Hub, w http.ResponseWriter, r *http.Request) {
 		defer cancel()
 
 		// Fetch portfolios from the database
-		portfolios, err := controllers.GetPortfolios(ctx)
+		portfolios, err := room.Store.ListPortfolios(ctx)
 		if err != nil {
 			log.Println("Failed to get portfolios:", err)
 